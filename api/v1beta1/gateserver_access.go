@@ -0,0 +1,167 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// gateServerAccessPath is the path of the GateServer access review webhook
+const gateServerAccessPath = "/validate-kubegateway-kubevirt-io-v1beta1-gateserver-access"
+
+// +kubebuilder:webhook:path=/validate-kubegateway-kubevirt-io-v1beta1-gateserver-access,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gateservers,verbs=create;update,versions=v1beta1,name=vgateserveraccess.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+
+// gateServerAccessValidator guards against privilege escalation using the operator permissions,
+// the operator grants the gateway service account permissions outside the server namespace only
+// for a requester allowed to create the role bindings in the target namespaces, or the cluster
+// role binding when the scope is Cluster. A referenced cluster role is bound only for a requester
+// allowed to bind it in each namespace the gateway is granted permissions in.
+type gateServerAccessValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &gateServerAccessValidator{}
+var _ admission.DecoderInjector = &gateServerAccessValidator{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *gateServerAccessValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler, reviews the access of the requester when the server is created,
+// and on updates changing the permissions granted to the gateway.
+func (v *gateServerAccessValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	s := &GateServer{}
+	if err := v.decoder.Decode(req, s); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if req.Operation == admissionv1.Update {
+		old := &GateServer{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if s.DeletionTimestamp != nil || !permissionsChanged(old, s) {
+			return admission.Allowed("")
+		}
+	}
+
+	denied, err := reviewRequesterAccess(ctx, v.client, req, serverAccessReviews(s))
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(denied) > 0 {
+		return admission.Denied(fmt.Sprintf("user %s can not grant the gateway service account permissions the user is not allowed to grant: %s",
+			req.UserInfo.Username, strings.Join(denied, ", ")))
+	}
+
+	return admission.Allowed("")
+}
+
+// permissionsChanged checks if an update changes the permissions granted to the gateway service account,
+// the referenced cluster role or the namespaces it is bound in.
+func permissionsChanged(old *GateServer, s *GateServer) bool {
+	return old.Spec.ClusterRole != s.Spec.ClusterRole ||
+		old.Spec.Scope != s.Spec.Scope ||
+		!equality.Semantic.DeepEqual(old.Spec.TargetNamespaces, s.Spec.TargetNamespaces)
+}
+
+// grantNamespaces returns the namespaces the gateway service account is granted permissions in,
+// the server namespace and the target namespaces, or a single empty namespace, meaning all
+// namespaces, when the server scope is Cluster.
+func (s *GateServer) grantNamespaces() []string {
+	if s.Spec.Scope == ScopeCluster {
+		return []string{""}
+	}
+
+	namespaces := []string{s.Namespace}
+	for _, namespace := range s.Spec.TargetNamespaces {
+		if namespace != s.Namespace {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
+
+// serverAccessReviews returns the access reviews of the permissions granted to the gateway,
+// keyed by a description of the access.
+func serverAccessReviews(s *GateServer) map[string]authorizationv1.SubjectAccessReviewSpec {
+	reviews := map[string]authorizationv1.SubjectAccessReviewSpec{}
+
+	for _, namespace := range s.grantNamespaces() {
+		switch namespace {
+		case s.Namespace:
+			continue
+		case "":
+			reviews["create clusterrolebindings"] = authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     "create",
+					Group:    "rbac.authorization.k8s.io",
+					Version:  "v1",
+					Resource: "clusterrolebindings",
+				},
+			}
+		default:
+			reviews[fmt.Sprintf("create rolebindings %s", namespaceDescription(namespace))] = authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      "create",
+					Group:     "rbac.authorization.k8s.io",
+					Version:   "v1",
+					Resource:  "rolebindings",
+				},
+			}
+		}
+	}
+
+	if s.Spec.ClusterRole != "" {
+		for _, namespace := range s.grantNamespaces() {
+			reviews[fmt.Sprintf("bind clusterrole %s %s", s.Spec.ClusterRole, namespaceDescription(namespace))] = authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      "bind",
+					Group:     "rbac.authorization.k8s.io",
+					Version:   "v1",
+					Resource:  "clusterroles",
+					Name:      s.Spec.ClusterRole,
+				},
+			}
+		}
+	}
+
+	return reviews
+}
+
+// namespaceDescription describes the namespace of an access review
+func namespaceDescription(namespace string) string {
+	if namespace == "" {
+		return "in all namespaces"
+	}
+	return fmt.Sprintf("in namespace %s", namespace)
+}
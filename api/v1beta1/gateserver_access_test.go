@@ -0,0 +1,224 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// requester is the user making the admission requests of the access review tests,
+// each spec uses a new requester, so access granted by a spec is not used by other specs.
+var requester string
+
+// admissionRequest returns an admission request of the requester, creating the object,
+// or updating the old object when it is not nil.
+func admissionRequest(old runtime.Object, obj runtime.Object) admission.Request {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: requester},
+	}}
+
+	raw, err := json.Marshal(obj)
+	Expect(err).NotTo(HaveOccurred())
+	req.Object.Raw = raw
+
+	if old != nil {
+		oldRaw, err := json.Marshal(old)
+		Expect(err).NotTo(HaveOccurred())
+		req.Operation = admissionv1.Update
+		req.OldObject.Raw = oldRaw
+	}
+
+	return req
+}
+
+// createNamespace creates a namespace with a generated name, and returns its name
+func createNamespace() string {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "access-review-"}}
+	Expect(k8sClient.Create(context.Background(), namespace)).To(Succeed())
+
+	return namespace.Name
+}
+
+// grantRequester grants the requester the rule, in a namespace, or in all namespaces when
+// the namespace is empty.
+func grantRequester(namespace string, rule rbacv1.PolicyRule) {
+	ctx := context.Background()
+
+	clusterrole := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "access-review-"},
+		Rules:      []rbacv1.PolicyRule{rule},
+	}
+	Expect(k8sClient.Create(ctx, clusterrole)).To(Succeed())
+
+	subjects := []rbacv1.Subject{{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: requester}}
+	roleRef := rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: clusterrole.Name}
+	if namespace == "" {
+		binding := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{GenerateName: "access-review-"}, Subjects: subjects, RoleRef: roleRef}
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+		return
+	}
+
+	binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{GenerateName: "access-review-", Namespace: namespace}, Subjects: subjects, RoleRef: roleRef}
+	Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+}
+
+var _ = Describe("GateServer access review", func() {
+	var validator *gateServerAccessValidator
+	var namespace string
+
+	// bindRule allows binding the vm-viewer cluster role
+	bindRule := rbacv1.PolicyRule{
+		APIGroups:     []string{"rbac.authorization.k8s.io"},
+		Resources:     []string{"clusterroles"},
+		ResourceNames: []string{"vm-viewer"},
+		Verbs:         []string{"bind"},
+	}
+
+	newServer := func() *GateServer {
+		s := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+		s.Spec.ClusterRole = "vm-viewer"
+		return s
+	}
+
+	BeforeEach(func() {
+		validator = &gateServerAccessValidator{client: k8sClient}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+
+		namespace = createNamespace()
+		requester = "developer-" + namespace
+	})
+
+	It("denies binding a cluster role the requester can not bind", func() {
+		resp := validator.Handle(context.Background(), admissionRequest(nil, newServer()))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(ContainSubstring("bind clusterrole vm-viewer in namespace " + namespace))
+	})
+
+	It("allows binding a cluster role the requester can bind in the server namespace", func() {
+		grantRequester(namespace, bindRule)
+
+		Eventually(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, newServer())).Allowed
+		}).Should(BeTrue())
+	})
+
+	It("reviews binding the cluster role in each target namespace", func() {
+		grantRequester(namespace, bindRule)
+		s := newServer()
+		s.Spec.TargetNamespaces = []string{createNamespace()}
+
+		Consistently(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, s)).Allowed
+		}).Should(BeFalse())
+	})
+
+	It("does not review updates keeping the gateway permissions", func() {
+		old := newServer()
+		s := newServer()
+		s.Spec.Route = "gateway.example.com"
+
+		resp := validator.Handle(context.Background(), admissionRequest(old, s))
+		Expect(resp.Allowed).To(BeTrue())
+
+		s.Spec.ClusterRole = "cluster-admin"
+		resp = validator.Handle(context.Background(), admissionRequest(old, s))
+		Expect(resp.Allowed).To(BeFalse())
+	})
+})
+
+var _ = Describe("GateServer scope access review", func() {
+	var validator *gateServerAccessValidator
+	var namespace string
+
+	// bindingRule allows creating role bindings, or cluster role bindings
+	bindingRule := func(resource string) rbacv1.PolicyRule {
+		return rbacv1.PolicyRule{
+			APIGroups: []string{"rbac.authorization.k8s.io"},
+			Resources: []string{resource},
+			Verbs:     []string{"create"},
+		}
+	}
+
+	BeforeEach(func() {
+		validator = &gateServerAccessValidator{client: k8sClient}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+
+		namespace = createNamespace()
+		requester = "developer-" + namespace
+	})
+
+	It("allows a server scoped to its own namespace", func() {
+		s := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+
+		resp := validator.Handle(context.Background(), admissionRequest(nil, s))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	It("denies target namespaces the requester can not create role bindings in", func() {
+		target := createNamespace()
+		s := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+		s.Spec.TargetNamespaces = []string{target}
+
+		resp := validator.Handle(context.Background(), admissionRequest(nil, s))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(ContainSubstring("create rolebindings in namespace " + target))
+	})
+
+	It("allows target namespaces the requester can create role bindings in", func() {
+		target := createNamespace()
+		grantRequester(target, bindingRule("rolebindings"))
+		s := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+		s.Spec.TargetNamespaces = []string{target}
+
+		Eventually(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, s)).Allowed
+		}).Should(BeTrue())
+	})
+
+	It("denies the Cluster scope when the requester can not create cluster role bindings", func() {
+		grantRequester(namespace, bindingRule("rolebindings"))
+		old := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+		s := old.DeepCopy()
+		s.Spec.Scope = ScopeCluster
+
+		Consistently(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(old, s)).Allowed
+		}).Should(BeFalse())
+	})
+
+	It("allows the Cluster scope when the requester can create cluster role bindings", func() {
+		grantRequester("", bindingRule("clusterrolebindings"))
+		s := &GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: namespace}}
+		s.Spec.Scope = ScopeCluster
+
+		Eventually(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, s)).Allowed
+		}).Should(BeTrue())
+	})
+})
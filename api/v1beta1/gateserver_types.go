@@ -17,18 +17,123 @@ limitations under the License.
 package v1beta1
 
 import (
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// KeyRotation defines the rotation policy of the JWT signing key
+type KeyRotation struct {
+	// interval is the time a signing key is used before a new key is generated,
+	// e.g. "720h".
+	// Defalut value is "720h".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:default:="720h"
+	Interval string `json:"interval,omitempty"`
+
+	// grace-period is the time a previous signing key is kept valid for verification after
+	// rotation, the key is also kept until the tokens it signed expire.
+	// Defalut value is "24h".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:default:="24h"
+	GracePeriod string `json:"grace-period,omitempty"`
+}
+
+// SigningKeyRef references a user supplied secret holding the JWT signing key
+type SigningKeyRef struct {
+	// name is the name of the secret, in the gate server namespace.
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+
+	// key-file is the secret entry holding the PEM encoded private key.
+	// Defalut value is "tls.key".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:default:="tls.key"
+	KeyFile string `json:"key-file,omitempty"`
+
+	// cert-file is the secret entry holding the PEM encoded certificate or public key.
+	// Defalut value is "tls.crt".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:default:="tls.crt"
+	CertFile string `json:"cert-file,omitempty"`
+}
+
+// ExternalSigner references a remote signing service holding the JWT signing key,
+// the service implements the Vault transit secrets engine API.
+type ExternalSigner struct {
+	// url is the address of the signing service, e.g. "https://vault.example.com:8200".
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:Pattern="^(http|https)://.*"
+	// +kubebuilder:validation:MaxLength=1024
+	URL string `json:"url"`
+
+	// mount-path is the path the transit secrets engine is mounted at.
+	// Defalut value is "transit".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:default:="transit"
+	MountPath string `json:"mount-path,omitempty"`
+
+	// key-name is the name of the signing key in the transit secrets engine.
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	KeyName string `json:"key-name"`
+
+	// credentials-secret is the name of a secret holding the signing service credentials,
+	// the "token" entry holds the access token, and the optional "ca.crt" entry holds the service CA bundle.
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	CredentialsSecret string `json:"credentials-secret"`
+}
+
+// SigningKeyStatus describes a JWT signing key
+type SigningKeyStatus struct {
+	// algorithm is the JWT signing algorithm of the key.
+	// +optional
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// id is the key ID set in the "kid" header of tokens signed by the key,
+	// the RFC 7638 thumbprint of the public key.
+	ID string `json:"id"`
+
+	// created is the time the key was generated.
+	Created metav1.Time `json:"created"`
+
+	// retired is the time the key was replaced by a new signing key,
+	// empty for the active key.
+	// +optional
+	Retired *metav1.Time `json:"retired,omitempty"`
+
+	// expires is the time the retired key is removed and tokens signed by it are no longer valid.
+	// +optional
+	Expires *metav1.Time `json:"expires,omitempty"`
+}
+
 // GateServerSpec defines the desired state of GateServer
 type GateServerSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// img is the kube-gateway image to use.
+	// Signing key entries other than "tls.key" and "tls.crt", verification of the previous keys
+	// during key rotation, token revocation, and issuer and audience checks require kube-gateway v0.2.0 or later, the version is read from the image tag, or from the "kubegateway.kubevirt.io/gateway-version"
+	// annotation when the tag is not a version, e.g. "latest".
 	// Defalut value is "quay.io/kubevirt-ui/kube-gateway:latest".
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Type="string"
@@ -45,7 +150,18 @@ type GateServerSpec struct {
 	// +kubebuilder:default:="https://kubernetes.default.svc"
 	APIURL string `json:"api-url,omitempty"`
 
+	// api-secret is the name of a secret holding the credentials used to access the k8s API at api-url,
+	// the "ca.crt" entry holds the API CA bundle, and the "token" entry holds the bearer token.
+	// Used to proxy a remote cluster, if left empty the gateway service account credentials are used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	APISecret string `json:"api-secret,omitempty"`
+
 	// route for the gate proxy server.
+	// The route host is the audience of the tokens signed for the server, set in their "aud" claim.
+	// The gateway checks the claim against the route host, not against the host of the request,
+	// so tokens are also accepted when the gateway is reached through its service or another host.
 	// +required
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Type="string"
@@ -53,6 +169,58 @@ type GateServerSpec struct {
 	// +kubebuilder:validation:MaxLength=226
 	Route string `json:"route,omitempty"`
 
+	// expose is the way the gate proxy server is exposed outside the cluster (Route|Ingress|HTTPRoute|None).
+	// Route requires the OpenShift route API, Ingress uses a networking.k8s.io ingress,
+	// HTTPRoute uses a Gateway API HTTPRoute attached to the gateway set in gateway-name.
+	// The gateway only serves https, Ingress requires ingress-nginx, and HTTPRoute requires
+	// the Gateway API BackendTLSPolicy resource.
+	// If left empty, Route is used when the cluster serves the route API, otherwise Ingress.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Route;Ingress;HTTPRoute;None
+	Expose string `json:"expose,omitempty"`
+
+	// ingress-class-name is the ingress class used when the server is exposed using an Ingress.
+	// If left empty, the cluster default ingress class is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	IngressClassName string `json:"ingress-class-name,omitempty"`
+
+	// gateway-name is the name of the Gateway API gateway the HTTPRoute is attached to.
+	// Required when the server is exposed using an HTTPRoute.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	GatewayName string `json:"gateway-name,omitempty"`
+
+	// gateway-namespace is the namespace of the Gateway API gateway the HTTPRoute is attached to.
+	// Defalut value is the namespace of the gate server.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=63
+	GatewayNamespace string `json:"gateway-namespace,omitempty"`
+
+	// cert-provider is the provider of the gate proxy server TLS serving certificate (ServiceCA|SelfSigned|CertManager).
+	// ServiceCA uses the OpenShift service-ca operator, SelfSigned uses a CA managed by the operator,
+	// CertManager requests the certificate from cert-manager.
+	// If left empty, ServiceCA is used on OpenShift, CertManager when cert-manager is installed, otherwise SelfSigned.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=ServiceCA;SelfSigned;CertManager
+	CertProvider string `json:"cert-provider,omitempty"`
+
+	// cert-issuer-name is the cert-manager issuer used to issue the serving certificate.
+	// If left empty, a self signed issuer is created for the server.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	CertIssuerName string `json:"cert-issuer-name,omitempty"`
+
+	// cert-issuer-kind is the kind of the cert-manager issuer (Issuer|ClusterIssuer).
+	// Defalut value is "Issuer".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	CertIssuerKind string `json:"cert-issuer-kind,omitempty"`
+
 	// admin-role is the verbs athorization role of the service (reader/admin)
 	// if service is role is reader, clients getting tokens to use this service
 	// will be able to excute get, watch and list verbs.
@@ -74,6 +242,75 @@ type GateServerSpec struct {
 	// +kubebuilder:validation:MaxLength=1024
 	// +kubebuilder:default:=""
 	AdminResources string `json:"admin-resources,omitempty"`
+
+	// rules is a list of policy rules granted to the gate proxy server service account,
+	// e.g. apiGroups: ["subresources.kubevirt.io"], resources: ["virtualmachineinstances/vnc"], verbs: ["get"].
+	// When set, admin-role and admin-resources are ignored.
+	// If left empty, the rules are converted from admin-role and admin-resources.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxItems=500
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+
+	// cluster-role is the name of an existing cluster role bound to the gate proxy server service account,
+	// e.g. a cluster role provided by KubeVirt.
+	// When set, no role is generated, and rules, admin-role and admin-resources are ignored.
+	// The requesting user must be allowed to bind the cluster role.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	ClusterRole string `json:"cluster-role,omitempty"`
+
+	// scope is the scope of the gate proxy server permissions (Namespace|Cluster).
+	// if scope is Namespace, the permissions are granted in the server namespace and in target-namespaces.
+	// if scope is Cluster, the permissions are granted in all namespaces using a cluster role binding,
+	// the requesting user must be allowed to create cluster role bindings.
+	// Defalut value is "Namespace".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Namespace;Cluster
+	// +kubebuilder:default:="Namespace"
+	Scope string `json:"scope,omitempty"`
+
+	// target-namespaces is a list of namespaces, in addition to the server namespace,
+	// the gate proxy server can access when scope is Namespace.
+	// The requesting user must be allowed to create role bindings in the target namespaces.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxItems=500
+	TargetNamespaces []string `json:"target-namespaces,omitempty"`
+
+	// signing-algorithm is the JWT signing algorithm (RS256|PS256|ES256|EdDSA),
+	// used to generate the signing key and to sign tokens.
+	// Changing the algorithm to one using a different key type generates a new signing key.
+	// Defalut value is "RS256".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=RS256;PS256;ES256;EdDSA
+	// +kubebuilder:default:="RS256"
+	SigningAlgorithm string `json:"signing-algorithm,omitempty"`
+
+	// rsa-key-size is the size in bits of generated RSA signing keys, used by the RS256 and PS256 algorithms.
+	// Defalut value is 4096.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=2048;3072;4096
+	// +kubebuilder:default:=4096
+	RSAKeySize int `json:"rsa-key-size,omitempty"`
+
+	// signing-key references a user supplied secret holding the JWT signing key,
+	// the key must match signing-algorithm.
+	// When set, no signing key is generated and key-rotation is ignored.
+	// +kubebuilder:validation:Optional
+	SigningKey *SigningKeyRef `json:"signing-key,omitempty"`
+
+	// external-signer references a remote signing service holding the JWT signing key,
+	// the private key never leaves the service, and only the public keys are stored in the cluster.
+	// The signing key type must match signing-algorithm.
+	// When set, signing-key and key-rotation are ignored.
+	// +kubebuilder:validation:Optional
+	ExternalSigner *ExternalSigner `json:"external-signer,omitempty"`
+
+	// key-rotation is the rotation policy of the JWT signing key.
+	// If left empty, the signing key is not rotated.
+	// Key rotation requires kube-gateway v0.2.0 or later, reported by the KeyRotationEnabled condition.
+	// +kubebuilder:validation:Optional
+	KeyRotation *KeyRotation `json:"key-rotation,omitempty"`
 }
 
 // GateServerStatus defines the observed state of GateServer
@@ -84,12 +321,50 @@ type GateServerStatus struct {
 	// Conditions represent the latest available observations of an object's state
 	Conditions []metav1.Condition `json:"conditions"`
 
-	// Token generation phase (ready|error)
+	// Gateway phase (Ready|Progressing|Degraded|Error)
 	Phase string `json:"phase"`
+
+	// replicas is the number of gateway pods targeted by the deployment.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// readyReplicas is the number of gateway pods ready to serve requests.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// servingCertExpiry is the expiry time of the gate proxy server TLS serving certificate.
+	// +optional
+	ServingCertExpiry *metav1.Time `json:"servingCertExpiry,omitempty"`
+
+	// observedGeneration is the most recent generation of the GateServer spec
+	// that was applied to the gateway resources.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// signingKeys lists the JWT signing keys valid for verification, the active key first.
+	// +optional
+	SigningKeys []SigningKeyStatus `json:"signingKeys,omitempty"`
+
+	// nextKeyRotation is the time the active signing key will be replaced.
+	// +optional
+	NextKeyRotation *metav1.Time `json:"nextKeyRotation,omitempty"`
+
+	// revokedTokens is the number of unexpired tokens in the token revocation list.
+	// +optional
+	RevokedTokens int `json:"revokedTokens,omitempty"`
+
+	// nextRevocationExpiry is the time the first token in the revocation list expires,
+	// and is pruned from the list.
+	// +optional
+	NextRevocationExpiry *metav1.Time `json:"nextRevocationExpiry,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas"
+// +kubebuilder:printcolumn:name="Route",type="string",JSONPath=".spec.route"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // GateServer is the Schema for the gateservers API
 type GateServer struct {
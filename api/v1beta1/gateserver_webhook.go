@@ -0,0 +1,114 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// MinKeyRotationInterval is the shortest signing key rotation interval
+const MinKeyRotationInterval = time.Hour
+
+// gateserverlog is for logging in this package.
+var gateserverlog = logf.Log.WithName("gateserver-resource")
+
+// SetupWebhookWithManager registers the GateServer admission webhooks with the manager
+func (r *GateServer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	webhookClient = mgr.GetClient()
+
+	mgr.GetWebhookServer().Register(gateServerAccessPath, &webhook.Admission{
+		Handler: &gateServerAccessValidator{client: mgr.GetClient()},
+	})
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-kubegateway-kubevirt-io-v1beta1-gateserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gateservers,verbs=create;update,versions=v1beta1,name=vgateserver.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &GateServer{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *GateServer) ValidateCreate() error {
+	gateserverlog.Info("validate create", "name", r.Name)
+
+	return invalidError("GateServer", r.Name, r.validateSpec(nil))
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *GateServer) ValidateUpdate(old runtime.Object) error {
+	gateserverlog.Info("validate update", "name", r.Name)
+
+	// Allow finalizers to be removed while the server is deleted
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+
+	return invalidError("GateServer", r.Name, r.validateSpec(old.(*GateServer)))
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *GateServer) ValidateDelete() error {
+	return nil
+}
+
+// validateSpec checks the server spec, secret references are checked only when they
+// differ from the old object, so a deleted secret does not block unrelated updates.
+func (r *GateServer) validateSpec(old *GateServer) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if r.Spec.KeyRotation != nil {
+		path := spec.Child("key-rotation")
+		if err := validateDuration(path.Child("interval"), r.Spec.KeyRotation.Interval, MinKeyRotationInterval, 0); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateDuration(path.Child("grace-period"), r.Spec.KeyRotation.GracePeriod, 0, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	oldSpec := GateServerSpec{}
+	if old != nil {
+		oldSpec = old.Spec
+	}
+
+	if r.Spec.APISecret != oldSpec.APISecret {
+		if err := validateSecretRef(spec.Child("api-secret"), r.Spec.APISecret, r.Namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if r.Spec.SigningKey != nil && (oldSpec.SigningKey == nil || oldSpec.SigningKey.Name != r.Spec.SigningKey.Name) {
+		if err := validateSecretRef(spec.Child("signing-key", "name"), r.Spec.SigningKey.Name, r.Namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if r.Spec.ExternalSigner != nil && (oldSpec.ExternalSigner == nil || oldSpec.ExternalSigner.CredentialsSecret != r.Spec.ExternalSigner.CredentialsSecret) {
+		if err := validateSecretRef(spec.Child("external-signer", "credentials-secret"), r.Spec.ExternalSigner.CredentialsSecret, r.Namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
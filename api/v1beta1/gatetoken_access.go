@@ -0,0 +1,267 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// gateTokenAccessPath is the path of the GateToken access review webhook
+const gateTokenAccessPath = "/validate-kubegateway-kubevirt-io-v1beta1-gatetoken-access"
+
+// +kubebuilder:webhook:path=/validate-kubegateway-kubevirt-io-v1beta1-gatetoken-access,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=create;update,versions=v1beta1,name=vgatetokenaccess.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// gateTokenAccessValidator guards against privilege escalation, a token is only signed for
+// a requester allowed to perform each verb on each URL of the token, and to read the signing
+// key secret when it is in another namespace.
+type gateTokenAccessValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &gateTokenAccessValidator{}
+var _ admission.DecoderInjector = &gateTokenAccessValidator{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *gateTokenAccessValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler, reviews the access of the requester when the token is created,
+// and on updates changing the access the token allows or signing a new token.
+func (v *gateTokenAccessValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	token := &GateToken{}
+	if err := v.decoder.Decode(req, token); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if req.Operation == admissionv1.Update {
+		old := &GateToken{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if token.DeletionTimestamp != nil || !accessChanged(old, token) {
+			return admission.Allowed("")
+		}
+	}
+
+	denied, err := v.reviewAccess(ctx, req, token)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(denied) > 0 {
+		return admission.Denied(fmt.Sprintf("user %s can not sign a token allowing access the user does not have: %s",
+			req.UserInfo.Username, strings.Join(denied, ", ")))
+	}
+
+	return admission.Allowed("")
+}
+
+// accessChanged checks if an update changes the access allowed by the token, the urls, verbs or signing key.
+// A token that failed signing is signed once fixed, so changes are reviewed whether the token is signed or not.
+// Incrementing reissue signs a new token on behalf of the requester, and is reviewed too.
+func accessChanged(old *GateToken, token *GateToken) bool {
+	return !equality.Semantic.DeepEqual(old.Spec.URLs, token.Spec.URLs) ||
+		!equality.Semantic.DeepEqual(old.Spec.Verbs, token.Spec.Verbs) ||
+		old.Spec.GateServerRef != token.Spec.GateServerRef ||
+		old.Spec.SecretName != token.Spec.SecretName ||
+		old.Spec.SecretNamespace != token.Spec.SecretNamespace ||
+		old.Spec.SecretFile != token.Spec.SecretFile ||
+		old.Spec.Reissue != token.Spec.Reissue
+}
+
+// reviewAccess runs a subject access review of the requester for each access granted by the token,
+// returns a description of the denied accesses.
+func (v *gateTokenAccessValidator) reviewAccess(ctx context.Context, req admission.Request, token *GateToken) ([]string, error) {
+	reviews := map[string]authorizationv1.SubjectAccessReviewSpec{}
+
+	for _, pattern := range token.Spec.URLs {
+		for _, verb := range token.Spec.Verbs {
+			for _, spec := range tokenAccessReviews(pattern, verb) {
+				reviews[reviewDescription(spec, pattern)] = spec
+			}
+		}
+	}
+
+	if token.Spec.SecretNamespace != "" && token.Spec.SecretNamespace != token.Namespace {
+		reviews[fmt.Sprintf("get secret %s/%s", token.Spec.SecretNamespace, token.Spec.SecretName)] = authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: token.Spec.SecretNamespace,
+				Verb:      "get",
+				Version:   "v1",
+				Resource:  "secrets",
+				Name:      token.Spec.SecretName,
+			},
+		}
+	}
+
+	return reviewRequesterAccess(ctx, v.client, req, reviews)
+}
+
+// isGlob checks if a URL pattern segment uses glob wildcards
+func isGlob(segment string) bool {
+	return strings.ContainsAny(segment, "*?[")
+}
+
+// tokenAccessReviews returns the access reviews of a token URL pattern and verb. Resource paths,
+// e.g. "/api/v1/namespaces/ns/pods/name/log", are reviewed as resource attributes, other paths as
+// non resource attributes. A segment using glob wildcards matches any value, and so does every
+// segment after it, e.g. "/apis/kubevirt.io/*" requires access to all the group resources.
+func tokenAccessReviews(pattern string, verb string) []authorizationv1.SubjectAccessReviewSpec {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	globAt := func(i int) bool {
+		return i < len(segments) && isGlob(segments[i])
+	}
+
+	// segment returns the path segment i, or "*" once a glob segment is reached,
+	// ok is false when the path has no segment i.
+	wildcard := false
+	segment := func(i int) (value string, ok bool) {
+		wildcard = wildcard || globAt(i)
+		if wildcard {
+			return "*", true
+		}
+		if i >= len(segments) {
+			return "", false
+		}
+		return segments[i], true
+	}
+
+	attributes := &authorizationv1.ResourceAttributes{}
+	rest := 0
+	switch {
+	case segments[0] == "api" && (len(segments) >= 3 || globAt(1)):
+		attributes.Version, _ = segment(1)
+		rest = 2
+	case segments[0] == "apis" && (len(segments) >= 4 || globAt(1) || globAt(2)):
+		attributes.Group, _ = segment(1)
+		attributes.Version, _ = segment(2)
+		rest = 3
+	default:
+		return nonResourceAccessReviews(pattern, verb)
+	}
+
+	// Namespaced resources, "namespaces/<namespace>/<resource>", a wildcard namespace matches all namespaces
+	if !wildcard && len(segments) > rest+1 && segments[rest] == "namespaces" && (len(segments) > rest+2 || globAt(rest+1)) {
+		if namespace, _ := segment(rest + 1); namespace != "*" {
+			attributes.Namespace = namespace
+		}
+		rest += 2
+	}
+
+	attributes.Resource, _ = segment(rest)
+	name, named := segment(rest + 1)
+	if name != "*" {
+		attributes.Name = name
+	}
+	attributes.Subresource, _ = segment(rest + 2)
+
+	// A path without a name is a collection, a path with a wildcard name may be any
+	verbs := []string{}
+	switch resourceVerb(verb) {
+	case "get":
+		if named {
+			verbs = append(verbs, "get")
+		}
+		if !named || name == "*" {
+			verbs = append(verbs, "list")
+		}
+	case "delete":
+		if named {
+			verbs = append(verbs, "delete")
+		}
+		if !named || name == "*" {
+			verbs = append(verbs, "deletecollection")
+		}
+	default:
+		verbs = append(verbs, resourceVerb(verb))
+	}
+
+	// A wildcard subresource also matches the resource itself
+	subresources := []string{attributes.Subresource}
+	if attributes.Subresource == "*" {
+		subresources = append(subresources, "")
+	}
+
+	specs := []authorizationv1.SubjectAccessReviewSpec{}
+	for _, v := range verbs {
+		for _, subresource := range subresources {
+			a := *attributes
+			a.Verb = v
+			a.Subresource = subresource
+			specs = append(specs, authorizationv1.SubjectAccessReviewSpec{ResourceAttributes: &a})
+		}
+	}
+
+	return specs
+}
+
+// nonResourceAccessReviews returns the access review of a non resource URL pattern, a trailing
+// wildcard is kept, other patterns using wildcards are reduced to their prefix.
+func nonResourceAccessReviews(pattern string, verb string) []authorizationv1.SubjectAccessReviewSpec {
+	path := pattern
+	if i := strings.IndexAny(path, "*?["); i != -1 {
+		path = path[:i] + "*"
+	}
+
+	return []authorizationv1.SubjectAccessReviewSpec{{
+		NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+			Path: path,
+			Verb: strings.ToLower(verb),
+		},
+	}}
+}
+
+// resourceVerb maps a token verb to the kubernetes API verb, http methods are mapped to the
+// verb of the matching API request
+func resourceVerb(verb string) string {
+	switch verb = strings.ToLower(verb); verb {
+	case "head", "options":
+		return "get"
+	case "post":
+		return "create"
+	case "put":
+		return "update"
+	default:
+		return verb
+	}
+}
+
+// reviewDescription describes the access of a token URL pattern reviewed by an access review
+func reviewDescription(spec authorizationv1.SubjectAccessReviewSpec, pattern string) string {
+	if spec.NonResourceAttributes != nil {
+		return fmt.Sprintf("%s %s", spec.NonResourceAttributes.Verb, pattern)
+	}
+
+	a := spec.ResourceAttributes
+	resource := a.Resource
+	if a.Subresource != "" {
+		resource = fmt.Sprintf("%s/%s", a.Resource, a.Subresource)
+	}
+	return fmt.Sprintf("%s %s (%s)", a.Verb, pattern, resource)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GateToken access review", func() {
+	var validator *gateTokenAccessValidator
+	var namespace string
+
+	// podsRule allows reading the pods
+	podsRule := rbacv1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get", "list"},
+	}
+
+	newToken := func() *GateToken {
+		token := &GateToken{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: namespace}}
+		token.Spec.GateServerRef = "gateserver-sample"
+		token.Spec.URLs = []string{"/api/v1/namespaces/" + namespace + "/pods"}
+		token.Spec.Verbs = []string{"get"}
+		return token
+	}
+
+	BeforeEach(func() {
+		validator = &gateTokenAccessValidator{client: k8sClient}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+
+		namespace = createNamespace()
+		requester = "developer-" + namespace
+	})
+
+	table.DescribeTable("reviews the access of a token url and verb",
+		func(pattern string, verb string, attributes authorizationv1.ResourceAttributes) {
+			specs := tokenAccessReviews(pattern, verb)
+			Expect(specs).To(HaveLen(1))
+			Expect(*specs[0].ResourceAttributes).To(Equal(attributes))
+		},
+		table.Entry("a collection", "/api/v1/namespaces/ns/pods", "get",
+			authorizationv1.ResourceAttributes{Namespace: "ns", Verb: "list", Version: "v1", Resource: "pods"}),
+		table.Entry("a named resource", "/api/v1/namespaces/ns/pods/example", "get",
+			authorizationv1.ResourceAttributes{Namespace: "ns", Verb: "get", Version: "v1", Resource: "pods", Name: "example"}),
+		table.Entry("a subresource", "/apis/subresources.kubevirt.io/v1/namespaces/ns/virtualmachineinstances/testvm/vnc", "get",
+			authorizationv1.ResourceAttributes{Namespace: "ns", Verb: "get", Group: "subresources.kubevirt.io", Version: "v1", Resource: "virtualmachineinstances", Name: "testvm", Subresource: "vnc"}),
+		table.Entry("an http method", "/api/v1/namespaces/ns/pods", "POST",
+			authorizationv1.ResourceAttributes{Namespace: "ns", Verb: "create", Version: "v1", Resource: "pods"}),
+		table.Entry("deleting a collection", "/api/v1/namespaces/ns/pods", "DELETE",
+			authorizationv1.ResourceAttributes{Namespace: "ns", Verb: "deletecollection", Version: "v1", Resource: "pods"}),
+	)
+
+	It("denies a token allowing access the requester does not have", func() {
+		resp := validator.Handle(context.Background(), admissionRequest(nil, newToken()))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(ContainSubstring("can not sign a token"))
+	})
+
+	It("allows a token allowing access the requester has", func() {
+		grantRequester(namespace, podsRule)
+
+		Eventually(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, newToken())).Allowed
+		}).Should(BeTrue())
+	})
+
+	It("reviews reading a signing key secret in another namespace", func() {
+		grantRequester(namespace, podsRule)
+		token := newToken()
+		token.Spec.SecretNamespace = createNamespace()
+		token.Spec.SecretName = "signing-key"
+
+		Consistently(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(nil, token)).Allowed
+		}).Should(BeFalse())
+	})
+
+	It("does not review updates keeping the token access", func() {
+		old := newToken()
+		token := old.DeepCopy()
+		token.Labels = map[string]string{"app": "example"}
+
+		resp := validator.Handle(context.Background(), admissionRequest(old, token))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	It("reviews widening the urls of a token that failed signing", func() {
+		grantRequester(namespace, podsRule)
+
+		// A token that failed signing is not signed, its spec can be changed
+		old := newToken()
+		old.Status.Phase = "Error"
+		token := old.DeepCopy()
+		token.Spec.URLs = []string{"/api/v1/pods"}
+
+		Consistently(func() bool {
+			return validator.Handle(context.Background(), admissionRequest(old, token)).Allowed
+		}).Should(BeFalse())
+	})
+
+	It("reviews reissuing a token", func() {
+		old := newToken()
+		token := old.DeepCopy()
+		token.Spec.Reissue = 1
+
+		resp := validator.Handle(context.Background(), admissionRequest(old, token))
+		Expect(resp.Allowed).To(BeFalse())
+	})
+})
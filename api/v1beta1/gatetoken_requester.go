@@ -0,0 +1,86 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// RequesterAnnotation is the annotation holding the name of the user requesting the token,
+// set in the "sub" claim of the signed token.
+const RequesterAnnotation = "kubegateway.kubevirt.io/requester"
+
+// gateTokenRequesterPath is the path of the GateToken requester webhook
+const gateTokenRequesterPath = "/mutate-kubegateway-kubevirt-io-v1beta1-gatetoken-requester"
+
+// +kubebuilder:webhook:path=/mutate-kubegateway-kubevirt-io-v1beta1-gatetoken-requester,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=create;update,versions=v1beta1,name=mgatetokenrequester.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+
+// gateTokenRequesterMutator records the user requesting a token, on creation or when reissue is
+// incremented, the user whose access was reviewed. On other updates the recorded user is kept.
+type gateTokenRequesterMutator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &gateTokenRequesterMutator{}
+var _ admission.DecoderInjector = &gateTokenRequesterMutator{}
+
+// InjectDecoder implements admission.DecoderInjector
+func (m *gateTokenRequesterMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler, sets the requester annotation of the token
+func (m *gateTokenRequesterMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	token := &GateToken{}
+	if err := m.decoder.Decode(req, token); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	requester := req.UserInfo.Username
+	if req.Operation == admissionv1.Update {
+		old := &GateToken{}
+		if err := m.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if token.Spec.Reissue == old.Spec.Reissue {
+			requester = old.Annotations[RequesterAnnotation]
+		}
+	}
+
+	if token.Annotations[RequesterAnnotation] == requester {
+		return admission.Allowed("")
+	}
+	if requester == "" {
+		delete(token.Annotations, RequesterAnnotation)
+	} else {
+		metav1.SetMetaDataAnnotation(&token.ObjectMeta, RequesterAnnotation, requester)
+	}
+
+	marshaled, err := json.Marshal(token)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GateToken requester", func() {
+	var mutator *gateTokenRequesterMutator
+
+	newToken := func(requester string) *GateToken {
+		token := &GateToken{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "ns"}}
+		token.Spec.GateServerRef = "gateserver-sample"
+		if requester != "" {
+			token.Annotations = map[string]string{RequesterAnnotation: requester}
+		}
+		return token
+	}
+
+	BeforeEach(func() {
+		mutator = &gateTokenRequesterMutator{}
+		Expect(mutator.InjectDecoder(decoder)).To(Succeed())
+		requester = "developer"
+	})
+
+	It("records the user creating the token", func() {
+		resp := mutator.Handle(context.Background(), admissionRequest(nil, newToken("")))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Value).To(Equal(map[string]interface{}{RequesterAnnotation: "developer"}))
+	})
+
+	It("replaces a requester set by the user creating the token", func() {
+		resp := mutator.Handle(context.Background(), admissionRequest(nil, newToken("admin")))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Value).To(Equal("developer"))
+	})
+
+	It("keeps the requester on updates that do not reissue the token", func() {
+		old := newToken("admin")
+		token := newToken("developer")
+		token.Labels = map[string]string{"app": "example"}
+
+		resp := mutator.Handle(context.Background(), admissionRequest(old, token))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Value).To(Equal("admin"))
+	})
+
+	It("records the user reissuing the token", func() {
+		old := newToken("admin")
+		token := newToken("admin")
+		token.Spec.Reissue = 1
+
+		resp := mutator.Handle(context.Background(), admissionRequest(old, token))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Value).To(Equal("developer"))
+	})
+})
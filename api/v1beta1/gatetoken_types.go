@@ -17,14 +17,30 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Token delivery methods
+const (
+	// TokenDeliveryStatus writes the signed token to the token status
+	TokenDeliveryStatus = "Status"
+
+	// TokenDeliverySecret writes the signed token to a secret owned by the token
+	TokenDeliverySecret = "Secret"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // GateTokenCache stores initial token data
 type GateTokenCache struct {
+	ID       string   `json:"jti,omitempty"`
+	KeyID    string   `json:"kid,omitempty"`
+	Issuer   string   `json:"iss,omitempty"`
+	Audience string   `json:"aud,omitempty"`
+	Subject  string   `json:"sub,omitempty"`
+	IAt      int64    `json:"iat,omitempty"`
 	From     string   `json:"from"`
 	Until    string   `json:"until"`
 	Duration string   `json:"duration"`
@@ -34,6 +50,29 @@ type GateTokenCache struct {
 	URLs     []string `json:"urls"`
 }
 
+// SupersededToken describes a token replaced by a reissue
+type SupersededToken struct {
+	// reissue is the reissue counter of the spec the token was signed with.
+	Reissue int `json:"reissue"`
+
+	// jti is the unique ID of the token, used to revoke it.
+	// +optional
+	ID string `json:"jti,omitempty"`
+
+	// kid is the ID of the key that signed the token.
+	// +optional
+	KeyID string `json:"kid,omitempty"`
+
+	// from is the time the token is valid from.
+	From string `json:"from"`
+
+	// until is the time the token expires.
+	Until string `json:"until"`
+
+	// superseded is the time the token was replaced.
+	Superseded metav1.Time `json:"superseded"`
+}
+
 // GateTokenSpec defines the desired state of GateToken
 type GateTokenSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -41,6 +80,7 @@ type GateTokenSpec struct {
 
 	// urls is a list of urls used to validate API request path,
 	// API requests matching one pattern will be validated by the token.
+	// Patterns are absolute paths that may use glob wildcards, without empty, "." or ".." segments.
 	// This field may not be empty.
 	// +required
 	// +kubebuilder:validation:Required
@@ -51,12 +91,14 @@ type GateTokenSpec struct {
 	// from is time of token invocation, the token will not validate before this time,
 	// the token duration will start from this time.
 	// Defalut to token object creation time.
+	// Default values are stored in the spec when the token is created.
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Type="string"
 	// +kubebuilder:validation:Format="date-time"
 	From string `json:"from"`
 
-	// duration is the duration the token will be validated since it's invocation.
+	// duration is the duration the token will be validated since it's invocation,
+	// at least "1s" and at most "720h".
 	// Defalut value is "1h".
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Type="string"
@@ -65,20 +107,30 @@ type GateTokenSpec struct {
 
 	// verbs is a comma separated list of allowed http methods,
 	// only API requests matching one of the allowed methods will be validated.
-	// Defalut value is "[GET,OPTIONS]".
+	// Defalut value is "[get]".
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:MaxItems=500
 	// +kubebuilder:validation:MinItems=1
 	Verbs []string `json:"verbs"`
 
+	// gateserver-ref is the name of the gate server, in the token namespace, the token is signed for.
+	// The token is signed using the server signing key, and the token urls must be in the server scope,
+	// urls that do not name a namespace are only in the scope of a server with Cluster scope.
+	// When set, secret-name, secret-namespace and secret-file are ignored.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type="string"
+	// +kubebuilder:validation:MaxLength=253
+	GateServerRef string `json:"gateserver-ref,omitempty"`
+
 	// secret-name is the name of the secret holding the private key used to sign the token.
-	// +kubebuilder:validation:Required
+	// Required when gateserver-ref is not set.
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Type="string"
 	// +kubebuilder:default:=""
 	SecretName string `json:"secret-name"`
 
 	// secret-namspace is the namespace of the secret holding the private key used to sign the token.
-	// Defalut value is "".
+	// Defalut value is the token namespace.
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Type="string"
 	// +kubebuilder:default:=""
@@ -90,6 +142,33 @@ type GateTokenSpec struct {
 	// +kubebuilder:validation:Type="string"
 	// +kubebuilder:default:="tls.key"
 	SecretFile string `json:"secret-file"`
+
+	// token-delivery is the way the signed token is delivered (Status|Secret).
+	// Status writes the token to the token status, Secret writes the token to the "token" entry
+	// of a secret owned by the token, and only the claims are kept in the status.
+	// Defalut value is "Status".
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Status;Secret
+	// +kubebuilder:default:="Status"
+	TokenDelivery string `json:"token-delivery,omitempty"`
+
+	// reissue is a counter used to request a new token, incrementing it signs a new token
+	// using the current spec, and records the previous token as superseded.
+	// The spec of a signed token can only be changed together with an increment of reissue.
+	// A reissued token is valid from the time it is signed, unless from is changed.
+	// Defalut value is 0.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Reissue int `json:"reissue,omitempty"`
+
+	// revoked revokes the token, and the tokens it superseded, before they expire.
+	// The IDs of the revoked tokens are added to the revocation list of the gate server,
+	// and the gateway rejects them. A revoked token can not be restored or reissued.
+	// Gateways older than kube-gateway v0.2.0 do not reject revoked tokens, the token phase is then Error.
+	// Deleting the token also revokes it.
+	// Defalut value is false.
+	// +kubebuilder:validation:Optional
+	Revoked bool `json:"revoked,omitempty"`
 }
 
 // GateTokenStatus defines the observed state of GateToken
@@ -100,14 +179,34 @@ type GateTokenStatus struct {
 	// Conditions represent the latest available observations of an object's state
 	Conditions []metav1.Condition `json:"conditions"`
 
-	// The generated token
+	// The generated token, empty when the token is delivered using a secret, or revoked
 	Token string `json:"token"`
 
+	// tokenSecretRef references the secret holding the generated token in the "token" entry,
+	// set when the token is delivered using a secret, until the token is revoked.
+	// +optional
+	TokenSecretRef *corev1.LocalObjectReference `json:"tokenSecretRef,omitempty"`
+
 	// Cached data, once created, user can not change this valuse
 	Data GateTokenCache `json:"data"`
 
-	// Token generation phase (ready|error)
+	// Token generation phase (ready|error|revoked)
 	Phase string `json:"phase"`
+
+	// route is the host of the gate server the token is signed for, set when gateserver-ref is set.
+	// The token audience, the "aud" claim, is the route host, and the token is only accepted by
+	// the gate server with this route, whatever host the gateway is reached through.
+	// +optional
+	Route string `json:"route,omitempty"`
+
+	// reissue is the reissue counter of the spec the token was signed with.
+	// +optional
+	Reissue int `json:"reissue,omitempty"`
+
+	// superseded lists the tokens replaced by a reissue, the most recent first.
+	// Superseded tokens remain valid until they expire.
+	// +optional
+	Superseded []SupersededToken `json:"superseded,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -122,6 +221,11 @@ type GateToken struct {
 	Status GateTokenStatus `json:"status,omitempty"`
 }
 
+// Signed checks if the token was signed, and delivered in the status or in a secret
+func (r *GateToken) Signed() bool {
+	return r.Status.Token != "" || r.Status.TokenSecretRef != nil
+}
+
 // +kubebuilder:object:root=true
 
 // GateTokenList contains a list of GateToken
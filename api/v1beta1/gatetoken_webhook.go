@@ -0,0 +1,298 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// MaxTokenDuration is the longest duration a token can be valid for
+const MaxTokenDuration = 720 * time.Hour
+
+// Default values of the token spec
+const (
+	DefaultTokenDuration   = "1h"
+	DefaultTokenSecretFile = "tls.key"
+)
+
+// DefaultTokenVerbs are the verbs allowed by a token when verbs is not set
+var DefaultTokenVerbs = []string{"get"}
+
+// tokenVerbs are the verbs a token can allow, kubernetes API verbs and http methods
+var tokenVerbs = []string{
+	"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection",
+	"head", "options", "post", "put",
+}
+
+// gatetokenlog is for logging in this package.
+var gatetokenlog = logf.Log.WithName("gatetoken-resource")
+
+// SetupWebhookWithManager registers the GateToken admission webhooks with the manager
+func (r *GateToken) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	webhookClient = mgr.GetClient()
+
+	mgr.GetWebhookServer().Register(gateTokenAccessPath, &webhook.Admission{
+		Handler: &gateTokenAccessValidator{client: mgr.GetClient()},
+	})
+	mgr.GetWebhookServer().Register(gateTokenRequesterPath, &webhook.Admission{
+		Handler: &gateTokenRequesterMutator{},
+	})
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-kubegateway-kubevirt-io-v1beta1-gatetoken,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=create;update,versions=v1beta1,name=mgatetoken.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &GateToken{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type,
+// the defaults are stored in the spec, making explicit the values used to sign the token.
+// The token controller applies the same defaults to tokens created without the webhook.
+func (r *GateToken) Default() {
+	gatetokenlog.Info("default", "name", r.Name)
+
+	// A reissued token starts at the time it is signed, unless from is changed
+	reissued := r.Spec.Reissue != r.Status.Reissue
+	if reissued && r.Spec.From == r.Status.Data.From {
+		r.Spec.From = ""
+	}
+
+	// Tokens signed before the defaults were stored start at the time they were signed
+	if r.Spec.From == "" {
+		if r.Status.Data.From != "" && !reissued {
+			r.Spec.From = r.Status.Data.From
+		} else {
+			r.Spec.From = time.Now().UTC().Format(time.RFC3339)
+		}
+	}
+	if r.Spec.Duration == "" {
+		r.Spec.Duration = DefaultTokenDuration
+	}
+	if len(r.Spec.Verbs) == 0 {
+		r.Spec.Verbs = append([]string{}, DefaultTokenVerbs...)
+	}
+	if r.Spec.TokenDelivery == "" {
+		r.Spec.TokenDelivery = TokenDeliveryStatus
+	}
+	// The signing key of a gate server is resolved from the server spec
+	if r.Spec.GateServerRef != "" {
+		return
+	}
+	if r.Spec.SecretNamespace == "" {
+		r.Spec.SecretNamespace = r.Namespace
+	}
+	if r.Spec.SecretFile == "" {
+		r.Spec.SecretFile = DefaultTokenSecretFile
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-kubegateway-kubevirt-io-v1beta1-gatetoken,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=create;update,versions=v1beta1,name=vgatetoken.kubegateway.kubevirt.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &GateToken{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *GateToken) ValidateCreate() error {
+	gatetokenlog.Info("validate create", "name", r.Name)
+
+	return invalidError("GateToken", r.Name, r.validateSpec(nil))
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *GateToken) ValidateUpdate(old runtime.Object) error {
+	gatetokenlog.Info("validate update", "name", r.Name)
+
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+
+	errs := r.validateSpec(old.(*GateToken))
+	errs = append(errs, r.validateImmutable(old.(*GateToken))...)
+
+	return invalidError("GateToken", r.Name, errs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *GateToken) ValidateDelete() error {
+	return nil
+}
+
+// validateSpec checks the token spec, the secret reference is checked only when it
+// differs from the old object, so a deleted secret does not block unrelated updates.
+func (r *GateToken) validateSpec(old *GateToken) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if r.Spec.From != "" {
+		if _, err := time.Parse(time.RFC3339, r.Spec.From); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("from"), r.Spec.From, "must be an RFC 3339 date-time, e.g. \"2021-06-01T10:00:00Z\""))
+		}
+	}
+	if err := validateDuration(spec.Child("duration"), r.Spec.Duration, time.Second, MaxTokenDuration); err != nil {
+		errs = append(errs, err)
+	}
+
+	for i, pattern := range r.Spec.URLs {
+		if msg := validateURLPattern(pattern); msg != "" {
+			errs = append(errs, field.Invalid(spec.Child("urls").Index(i), pattern, msg))
+		}
+	}
+	for i, verb := range r.Spec.Verbs {
+		if !isTokenVerb(verb) {
+			errs = append(errs, field.NotSupported(spec.Child("verbs").Index(i), verb, tokenVerbs))
+		}
+	}
+
+	if r.Spec.GateServerRef != "" {
+		if old == nil || old.Spec.GateServerRef != r.Spec.GateServerRef {
+			errs = append(errs, validateGateServerRef(spec.Child("gateserver-ref"), r)...)
+		}
+		return errs
+	}
+
+	if r.Spec.SecretName == "" {
+		errs = append(errs, field.Required(spec.Child("secret-name"), "one of gateserver-ref or secret-name is required"))
+	}
+
+	namespace := r.Spec.SecretNamespace
+	if namespace == "" {
+		namespace = r.Namespace
+	}
+	if old == nil || old.Spec.SecretName != r.Spec.SecretName || old.Spec.SecretNamespace != r.Spec.SecretNamespace {
+		if err := validateSecretRef(spec.Child("secret-name"), r.Spec.SecretName, namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validateGateServerRef checks that the referenced gate server exists, and that the token urls are in its scope
+func validateGateServerRef(path *field.Path, r *GateToken) field.ErrorList {
+	if webhookClient == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	s := &GateServer{}
+	err := webhookClient.Get(ctx, types.NamespacedName{Name: r.Spec.GateServerRef, Namespace: r.Namespace}, s)
+	if apierrors.IsNotFound(err) {
+		return field.ErrorList{field.NotFound(path, r.Spec.GateServerRef)}
+	}
+	if err != nil {
+		return field.ErrorList{field.InternalError(path, err)}
+	}
+
+	errs := field.ErrorList{}
+	for i, pattern := range r.Spec.URLs {
+		if msg := s.URLScopeError(pattern); msg != "" {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "urls").Index(i), pattern, msg))
+		}
+	}
+
+	return errs
+}
+
+// validateImmutable checks that the spec of a signed token is only changed together with
+// an increment of reissue, or to revoke the token. A revoked token stays revoked.
+// The old spec is compared with its defaults applied, because the defaulting webhook
+// also stores the defaults of tokens created before it was enabled.
+func (r *GateToken) validateImmutable(old *GateToken) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if r.Spec.Reissue < old.Spec.Reissue {
+		errs = append(errs, field.Invalid(spec.Child("reissue"), r.Spec.Reissue, "must not be decreased"))
+	}
+	if old.Spec.Revoked {
+		if !r.Spec.Revoked {
+			errs = append(errs, field.Forbidden(spec.Child("revoked"), "a revoked token can not be restored"))
+		}
+		if r.Spec.Reissue > old.Spec.Reissue {
+			errs = append(errs, field.Forbidden(spec.Child("reissue"), "a revoked token can not be reissued, create a new token"))
+		}
+	}
+	if !old.Signed() || r.Spec.Reissue > old.Spec.Reissue {
+		return errs
+	}
+
+	// A signed token can be revoked
+	defaulted := old.DeepCopy()
+	defaulted.Default()
+	defaulted.Spec.Revoked = r.Spec.Revoked
+	if !equality.Semantic.DeepEqual(defaulted.Spec, r.Spec) {
+		errs = append(errs, field.Forbidden(spec, "the spec of a signed token can not be changed, increment spec.reissue to sign a new token"))
+	}
+
+	return errs
+}
+
+// validateURLPattern checks a token URL pattern, an absolute API path that may use glob wildcards.
+// Returns a description of the problem, or an empty string if the pattern is valid.
+func validateURLPattern(pattern string) string {
+	if !strings.HasPrefix(pattern, "/") {
+		return "must be an absolute path starting with \"/\""
+	}
+	if strings.IndexFunc(pattern, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) != -1 {
+		return "must not contain white space or control characters"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "must be a valid glob pattern"
+	}
+
+	u, err := url.Parse(pattern)
+	if err != nil || u.Host != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return "must be a path, without a host, a query or a fragment"
+	}
+
+	// Requests are matched before the path is cleaned, "/pods/x/../../secrets" would match "/pods/*"
+	for _, segment := range strings.Split(u.Path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "must not contain empty, \".\" or \"..\" path segments"
+		}
+	}
+
+	return ""
+}
+
+// isTokenVerb checks if a verb can be allowed by a token, verbs are case insensitive
+func isTokenVerb(verb string) bool {
+	for _, v := range tokenVerbs {
+		if strings.EqualFold(v, verb) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GateToken url validation", func() {
+	table.DescribeTable("accepts absolute API path patterns",
+		func(pattern string) {
+			Expect(validateURLPattern(pattern)).To(BeEmpty())
+		},
+		table.Entry("a path", "/api/v1/namespaces/ns/pods"),
+		table.Entry("a wildcard", "/apis/kubevirt.io/v1/namespaces/ns/*"),
+		table.Entry("a subresource", "/apis/subresources.kubevirt.io/v1/namespaces/ns/virtualmachineinstances/testvm/vnc"),
+	)
+
+	table.DescribeTable("rejects patterns that are not clean absolute API paths",
+		func(pattern string, msg string) {
+			Expect(validateURLPattern(pattern)).To(ContainSubstring(msg))
+		},
+		table.Entry("a relative path", "api/v1/pods", "absolute path"),
+		table.Entry("white space", "/api/v1/namespaces/ns/pods ", "white space"),
+		table.Entry("an invalid glob", "/api/v1/namespaces/[ns/pods", "glob"),
+		table.Entry("a host", "//example.com/api/v1/pods", "without a host"),
+		table.Entry("a query", "/api/v1/namespaces/ns/pods?watch=true", "without a host, a query"),
+		table.Entry("a parent segment", "/api/v1/namespaces/ns/pods/x/../../secrets", "path segments"),
+		table.Entry("an encoded parent segment", "/api/v1/namespaces/ns/pods/x/%2e%2e/%2e%2e/secrets", "path segments"),
+		table.Entry("a current segment", "/api/v1/namespaces/ns/./pods", "path segments"),
+		table.Entry("an empty segment", "/api/v1/namespaces//pods", "path segments"),
+		table.Entry("a trailing slash", "/api/v1/namespaces/ns/pods/", "path segments"),
+		table.Entry("the root path", "/", "path segments"),
+	)
+})
+
+var _ = Describe("GateToken defaulting", func() {
+	newToken := func() *GateToken {
+		token := &GateToken{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "ns"}}
+		token.Spec.URLs = []string{"/api/v1/namespaces/ns/pods"}
+		token.Spec.SecretName = "signing-key"
+		return token
+	}
+
+	It("stores the defaults the token is signed with", func() {
+		token := newToken()
+		token.Default()
+
+		Expect(token.Spec.Duration).To(Equal(DefaultTokenDuration))
+		Expect(token.Spec.Verbs).To(Equal(DefaultTokenVerbs))
+		Expect(token.Spec.TokenDelivery).To(Equal(TokenDeliveryStatus))
+		Expect(token.Spec.SecretNamespace).To(Equal("ns"))
+		Expect(token.Spec.SecretFile).To(Equal(DefaultTokenSecretFile))
+
+		from, err := time.Parse(time.RFC3339, token.Spec.From)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(from).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("keeps the values set in the spec", func() {
+		token := newToken()
+		token.Spec.From = "2021-06-01T00:00:00Z"
+		token.Spec.Duration = "8h"
+		token.Spec.Verbs = []string{"get", "post"}
+		token.Spec.SecretNamespace = "keys"
+		token.Spec.SecretFile = "signing.key"
+		token.Spec.TokenDelivery = TokenDeliverySecret
+		expected := token.Spec.DeepCopy()
+
+		token.Default()
+		Expect(token.Spec).To(Equal(*expected))
+	})
+
+	It("does not default the signing key secret of a token signed for a gate server", func() {
+		token := newToken()
+		token.Spec.SecretName = ""
+		token.Spec.GateServerRef = "gateserver-sample"
+		token.Default()
+
+		Expect(token.Spec.SecretNamespace).To(BeEmpty())
+		Expect(token.Spec.SecretFile).To(BeEmpty())
+	})
+
+	It("keeps the start time of a token signed before the defaults were stored", func() {
+		token := newToken()
+		token.Status.Data.From = "2021-06-01T00:00:00Z"
+		token.Default()
+
+		Expect(token.Spec.From).To(Equal("2021-06-01T00:00:00Z"))
+	})
+
+	It("starts a reissued token at the time it is signed, unless the start time is changed", func() {
+		token := newToken()
+		token.Spec.From = "2021-06-01T00:00:00Z"
+		token.Status.Data.From = token.Spec.From
+		token.Spec.Reissue = 1
+		token.Default()
+		Expect(token.Spec.From).NotTo(Equal("2021-06-01T00:00:00Z"))
+
+		token = newToken()
+		token.Spec.From = "2021-07-01T00:00:00Z"
+		token.Status.Data.From = "2021-06-01T00:00:00Z"
+		token.Spec.Reissue = 1
+		token.Default()
+		Expect(token.Spec.From).To(Equal("2021-07-01T00:00:00Z"))
+	})
+})
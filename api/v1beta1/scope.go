@@ -0,0 +1,69 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import "fmt"
+
+// ScopeCluster is the scope of a gate server with permissions in all namespaces
+const ScopeCluster = "Cluster"
+
+// InScope checks if the gate server can access a namespace, the server namespace
+// and the target namespaces, or any namespace when the server scope is Cluster.
+func (s *GateServer) InScope(namespace string) bool {
+	if s.Spec.Scope == ScopeCluster || namespace == s.Namespace {
+		return true
+	}
+	for _, target := range s.Spec.TargetNamespaces {
+		if target == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URLNamespace returns the namespace of a token URL pattern, e.g. "ns" for
+// "/api/v1/namespaces/ns/pods", or an empty string if the pattern does not
+// name a namespace.
+func URLNamespace(pattern string) string {
+	for _, spec := range tokenAccessReviews(pattern, "get") {
+		if spec.ResourceAttributes != nil {
+			return spec.ResourceAttributes.Namespace
+		}
+	}
+
+	return ""
+}
+
+// URLScopeError describes why a token URL pattern is not in the scope of the gate server, or returns
+// an empty string if it is. A pattern that does not name a namespace, a cluster scoped resource,
+// a wildcard namespace or a non resource URL, is only in the scope of a server with Cluster scope.
+func (s *GateServer) URLScopeError(pattern string) string {
+	if s.Spec.Scope == ScopeCluster {
+		return ""
+	}
+
+	namespace := URLNamespace(pattern)
+	if namespace == "" {
+		return fmt.Sprintf("url does not name a namespace, it is only in the scope of a gate server with %s scope, gate server %s", ScopeCluster, s.Name)
+	}
+	if !s.InScope(namespace) {
+		return fmt.Sprintf("namespace %s is not in the scope of gate server %s", namespace, s.Name)
+	}
+
+	return ""
+}
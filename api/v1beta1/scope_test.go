@@ -0,0 +1,55 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GateServer url scope", func() {
+	newServer := func(scope string) *GateServer {
+		s := &GateServer{}
+		s.Name = "gateserver-sample"
+		s.Namespace = "ns"
+		s.Spec.Scope = scope
+		s.Spec.TargetNamespaces = []string{"target"}
+		return s
+	}
+
+	table.DescribeTable("accepts urls in the server scope",
+		func(pattern string, scope string) {
+			Expect(newServer(scope).URLScopeError(pattern)).To(BeEmpty())
+		},
+		table.Entry("the server namespace", "/api/v1/namespaces/ns/pods", ""),
+		table.Entry("a target namespace", "/apis/kubevirt.io/v1/namespaces/target/*", ""),
+		table.Entry("a cluster resource in the Cluster scope", "/api/v1/nodes", ScopeCluster),
+		table.Entry("all APIs in the Cluster scope", "/apis/*", ScopeCluster),
+	)
+
+	table.DescribeTable("rejects urls out of the server scope",
+		func(pattern string) {
+			Expect(newServer("").URLScopeError(pattern)).NotTo(BeEmpty())
+		},
+		table.Entry("another namespace", "/api/v1/namespaces/other/pods"),
+		table.Entry("a cluster resource", "/api/v1/nodes"),
+		table.Entry("any namespace", "/api/v1/namespaces/*/pods"),
+		table.Entry("all APIs", "/apis/*"),
+		table.Entry("a non resource url", "/healthz"),
+	)
+})
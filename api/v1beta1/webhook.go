@@ -0,0 +1,117 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// webhookTimeout is the timeout of API requests made by the admission webhooks
+const webhookTimeout = 5 * time.Second
+
+// webhookClient is used by the admission webhooks to look up referenced objects,
+// set when the webhooks are registered with the manager.
+var webhookClient client.Reader
+
+// validateSecretRef checks that a referenced secret exists
+func validateSecretRef(path *field.Path, name string, namespace string) *field.Error {
+	if webhookClient == nil || name == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	secret := &corev1.Secret{}
+	err := webhookClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return field.NotFound(path, name)
+	}
+	if err != nil {
+		return field.InternalError(path, err)
+	}
+
+	return nil
+}
+
+// validateDuration checks that a duration is parsable and within limits, a zero max means no upper limit
+func validateDuration(path *field.Path, value string, min time.Duration, max time.Duration) *field.Error {
+	if value == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return field.Invalid(path, value, "must be a duration, e.g. \"30m\" or \"1h\"")
+	}
+	if duration < min {
+		return field.Invalid(path, value, "must be at least "+min.String())
+	}
+	if max > 0 && duration > max {
+		return field.Invalid(path, value, "must be at most "+max.String())
+	}
+
+	return nil
+}
+
+// invalidError returns the admission error of a list of field errors, or nil if the list is empty
+func invalidError(kind string, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: kind}, name, errs)
+}
+
+// reviewRequesterAccess runs a subject access review of the user making the admission request for
+// each of the reviews, keyed by a description of the access, returns the descriptions of the denied accesses.
+func reviewRequesterAccess(ctx context.Context, c client.Client, req admission.Request, reviews map[string]authorizationv1.SubjectAccessReviewSpec) ([]string, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	denied := []string{}
+	for description, spec := range reviews {
+		spec.User = req.UserInfo.Username
+		spec.UID = req.UserInfo.UID
+		spec.Groups = req.UserInfo.Groups
+		spec.Extra = extra
+
+		review := &authorizationv1.SubjectAccessReview{Spec: spec}
+		if err := c.Create(ctx, review); err != nil {
+			return nil, err
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, description)
+		}
+	}
+	sort.Strings(denied)
+
+	return denied, nil
+}
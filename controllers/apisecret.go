@@ -0,0 +1,76 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// getAPISecret reads the secret holding the credentials of the proxied k8s API,
+// and checks that it holds a CA bundle and a bearer token.
+func (r *GateServerReconciler) getAPISecret(ctx context.Context, s *kubegatewayv1beta1.GateServer) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: s.Spec.APISecret, Namespace: s.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	if len(secret.Data["token"]) == 0 {
+		return nil, fmt.Errorf("secret %s is missing the \"token\" entry", s.Spec.APISecret)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(secret.Data["ca.crt"]) {
+		return nil, fmt.Errorf("secret %s \"ca.crt\" entry does not hold a PEM CA bundle", s.Spec.APISecret)
+	}
+
+	return secret, nil
+}
+
+// reconcileAPISecret validates the k8s API credentials secret before it is mounted by the gateway
+func (r *GateServerReconciler) reconcileAPISecret(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	if s.Spec.APISecret == "" {
+		return nil
+	}
+
+	_, err := r.getAPISecret(ctx, s)
+	return err
+}
+
+// apiSecretHash returns a hash of the k8s API credentials, used to restart the
+// gateway pods when the credentials change.
+func (r *GateServerReconciler) apiSecretHash(ctx context.Context, s *kubegatewayv1beta1.GateServer) (string, error) {
+	if s.Spec.APISecret == "" {
+		return "", nil
+	}
+
+	secret, err := r.getAPISecret(ctx, s)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(secret.Data["ca.crt"])
+	h.Write(secret.Data["token"])
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
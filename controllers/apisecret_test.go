@@ -0,0 +1,133 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer k8s API", func() {
+	It("proxies the in-cluster API using the service account credentials by default", func() {
+		flags := gatewayFlags(newDeploymentServer("quay.io/kubevirt-ui/kube-gateway:latest"))
+		Expect(flags).To(HaveKeyWithValue("-api-server", defaultAPIURL))
+		Expect(flags).To(HaveKeyWithValue("-api-server-ca-file", serviceAccountCAFile))
+		Expect(flags).To(HaveKeyWithValue("-api-server-bearer-token-file", serviceAccountToken))
+	})
+
+	It("proxies the API set in the spec using the credentials secret", func() {
+		s := newDeploymentServer("quay.io/kubevirt-ui/kube-gateway:latest")
+		s.Spec.APIURL = "https://api.example.com:6443"
+		s.Spec.APISecret = "api-credentials"
+
+		flags := gatewayFlags(s)
+		Expect(flags).To(HaveKeyWithValue("-api-server", "https://api.example.com:6443"))
+		Expect(flags).To(HaveKeyWithValue("-api-server-ca-file", apiSecretMountPath+"/ca.crt"))
+		Expect(flags).To(HaveKeyWithValue("-api-server-bearer-token-file", apiSecretMountPath+"/token"))
+
+		r := newGateServerReconciler()
+		deployment, err := r.Deployment(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(podSpec.Volumes).To(ContainElement(WithTransform(func(v corev1.Volume) string {
+			if v.Secret == nil {
+				return ""
+			}
+			return v.Secret.SecretName
+		}, Equal("api-credentials"))))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "api-server", MountPath: apiSecretMountPath}))
+	})
+
+	Context("with a credentials secret", func() {
+		var r *GateServerReconciler
+		var s *kubegatewayv1beta1.GateServer
+		var secret *corev1.Secret
+
+		BeforeEach(func() {
+			ca, _, err := generateCA("api.example.com")
+			Expect(err).NotTo(HaveOccurred())
+
+			r = newGateServerReconciler()
+			s = newGateServer()
+			s.Spec.APIURL = "https://api.example.com:6443"
+			s.Spec.APISecret = "api-credentials"
+			Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: s.Spec.APISecret, Namespace: s.Namespace},
+				Data:       map[string][]byte{"ca.crt": ca, "token": []byte("api-token")},
+			}
+		})
+
+		It("fails to reconcile until the secret exists", func() {
+			stored, err := reconcileServer(r, s)
+			Expect(err).To(HaveOccurred())
+			Expect(meta.IsStatusConditionFalse(stored.Status.Conditions, "APISecretReconciled")).To(BeTrue())
+
+			Expect(k8sClient.Create(context.Background(), secret)).To(Succeed())
+			stored, err = reconcileServer(r, s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.FindStatusCondition(stored.Status.Conditions, "APISecretReconciled")).To(BeNil())
+		})
+
+		It("rejects a secret without a token", func() {
+			delete(secret.Data, "token")
+			Expect(k8sClient.Create(context.Background(), secret)).To(Succeed())
+
+			stored, err := reconcileServer(r, s)
+			Expect(err).To(MatchError(ContainSubstring(`missing the "token" entry`)))
+			Expect(meta.IsStatusConditionFalse(stored.Status.Conditions, "APISecretReconciled")).To(BeTrue())
+		})
+
+		It("rejects a secret without a PEM CA bundle", func() {
+			secret.Data["ca.crt"] = []byte("not a certificate")
+			Expect(k8sClient.Create(context.Background(), secret)).To(Succeed())
+
+			_, err := reconcileServer(r, s)
+			Expect(err).To(MatchError(ContainSubstring("PEM CA bundle")))
+		})
+
+		It("restarts the gateway pods when the credentials change", func() {
+			Expect(k8sClient.Create(context.Background(), secret)).To(Succeed())
+			_, err := reconcileServer(r, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(getObject(s, deployment)).To(Succeed())
+			hash := deployment.Spec.Template.Annotations["kubegateway.kubevirt.io/api-secret-hash"]
+			Expect(hash).NotTo(BeEmpty())
+
+			secret.Data["token"] = []byte("rotated-api-token")
+			Expect(k8sClient.Update(context.Background(), secret)).To(Succeed())
+			_, err = reconcileServer(r, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment = &appsv1.Deployment{}
+			Expect(getObject(s, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations["kubegateway.kubevirt.io/api-secret-hash"]).NotTo(Equal(hash))
+		})
+	})
+})
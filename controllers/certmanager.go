@@ -0,0 +1,116 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// certManagerGroupVersion is the cert-manager API used to request certificates,
+// the cert-manager types are not vendored, resources are built as unstructured objects.
+var certManagerGroupVersion = schema.GroupVersion{Group: "cert-manager.io", Version: "v1"}
+
+const (
+	// certManagerDuration is the validity of certificates requested from cert-manager
+	certManagerDuration = "2160h"
+
+	// certManagerRenewBefore is the time before expiry cert-manager renews the certificate
+	certManagerRenewBefore = "720h"
+)
+
+// certManagerProvider requests the serving certificate from cert-manager using a Certificate resource,
+// cert-manager issues the certificate and renews it before it expires.
+// If no issuer is set in the spec, a self signed issuer is created for the server.
+type certManagerProvider struct {
+	r *GateServerReconciler
+}
+
+func (p *certManagerProvider) serviceAnnotations(s *kubegatewayv1beta1.GateServer) map[string]string {
+	return map[string]string{}
+}
+
+func (p *certManagerProvider) reconcile(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	r := p.r
+	labels := map[string]string{
+		"app": s.Name,
+	}
+
+	issuerName := s.Spec.CertIssuerName
+	issuerKind := s.Spec.CertIssuerKind
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+
+	// Create a self signed issuer if the user did not set one
+	if issuerName == "" {
+		issuerName = fmt.Sprintf("%s-selfsigned", s.Name)
+		issuerKind = "Issuer"
+
+		issuer := &unstructured.Unstructured{}
+		issuer.SetGroupVersionKind(certManagerGroupVersion.WithKind("Issuer"))
+		issuer.SetName(issuerName)
+		issuer.SetNamespace(s.Namespace)
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, issuer, func() error {
+			issuer.SetLabels(mergeLabels(issuer.GetLabels(), labels))
+			issuer.Object["spec"] = map[string]interface{}{
+				"selfSigned": map[string]interface{}{},
+			}
+
+			return controllerutil.SetControllerReference(s, issuer, r.Scheme)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	dnsNames := []interface{}{}
+	for _, name := range servingDNSNames(s) {
+		dnsNames = append(dnsNames, name)
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certManagerGroupVersion.WithKind("Certificate"))
+	certificate.SetName(s.Name)
+	certificate.SetNamespace(s.Namespace)
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, certificate, func() error {
+		certificate.SetLabels(mergeLabels(certificate.GetLabels(), labels))
+		certificate.Object["spec"] = map[string]interface{}{
+			"secretName":  servingCertSecretName(s),
+			"commonName":  fmt.Sprintf("%s.%s.svc", s.Name, s.Namespace),
+			"dnsNames":    dnsNames,
+			"duration":    certManagerDuration,
+			"renewBefore": certManagerRenewBefore,
+			"usages":      []interface{}{"server auth", "digital signature", "key encipherment"},
+			"issuerRef": map[string]interface{}{
+				"name":  issuerName,
+				"kind":  issuerKind,
+				"group": certManagerGroupVersion.Group,
+			},
+		}
+
+		return controllerutil.SetControllerReference(s, certificate, r.Scheme)
+	})
+
+	return err
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Serving certificate providers
+const (
+	certProviderServiceCA   = "ServiceCA"
+	certProviderSelfSigned  = "SelfSigned"
+	certProviderCertManager = "CertManager"
+)
+
+// certProvider provides the TLS serving certificate of the gate proxy server,
+// the certificate and key are stored in the "<name>-secret" secret mounted by the deployment.
+type certProvider interface {
+	// reconcile makes sure the serving certificate is issued, and renewed before it expires
+	reconcile(ctx context.Context, s *kubegatewayv1beta1.GateServer) error
+
+	// serviceAnnotations are added to the gate proxy service
+	serviceAnnotations(s *kubegatewayv1beta1.GateServer) map[string]string
+}
+
+// servingCertSecretName is the name of the secret holding the serving certificate
+func servingCertSecretName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("%s-secret", s.Name)
+}
+
+// certProviderName returns the serving certificate provider of the server, when not set
+// in the spec the provider is detected using the APIs served by the cluster.
+func (r *GateServerReconciler) certProviderName(s *kubegatewayv1beta1.GateServer) string {
+	if s.Spec.CertProvider != "" {
+		return s.Spec.CertProvider
+	}
+
+	switch {
+	case r.APIs.ServiceCA:
+		return certProviderServiceCA
+	case r.APIs.CertManager:
+		return certProviderCertManager
+	default:
+		return certProviderSelfSigned
+	}
+}
+
+// certProvider returns the serving certificate provider of the server
+func (r *GateServerReconciler) certProvider(s *kubegatewayv1beta1.GateServer) certProvider {
+	switch r.certProviderName(s) {
+	case certProviderSelfSigned:
+		return &selfSignedProvider{r: r}
+	case certProviderCertManager:
+		return &certManagerProvider{r: r}
+	default:
+		return &serviceCAProvider{}
+	}
+}
+
+// reconcileServingCert issues the serving certificate and records it's expiry in the status
+func (r *GateServerReconciler) reconcileServingCert(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	if err := r.certProvider(s).reconcile(ctx, s); err != nil {
+		return err
+	}
+
+	// The certificate may be issued asynchronously by the provider
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: servingCertSecretName(s), Namespace: s.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		s.Status.ServingCertExpiry = nil
+		setServerCondition(s, metav1.Condition{
+			Type:    "ServingCertificateReady",
+			Status:  metav1.ConditionFalse,
+			Reason:  "Pending",
+			Message: fmt.Sprintf("Waiting for %s to issue the serving certificate", r.certProviderName(s)),
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return fmt.Errorf("can't parse serving certificate: %s", err)
+	}
+	s.Status.ServingCertExpiry = &metav1.Time{Time: cert.NotAfter}
+	setServerCondition(s, metav1.Condition{
+		Type:    "ServingCertificateReady",
+		Status:  metav1.ConditionTrue,
+		Reason:  "Issued",
+		Message: fmt.Sprintf("Serving certificate issued by %s", r.certProviderName(s)),
+	})
+
+	return nil
+}
+
+// servingCertHash returns a hash of the serving certificate, used to restart the
+// gateway pods when the certificate is renewed.
+func (r *GateServerReconciler) servingCertHash(ctx context.Context, s *kubegatewayv1beta1.GateServer) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: servingCertSecretName(s), Namespace: s.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(secret.Data[corev1.TLSCertKey])
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// servingCA returns the CA bundle that signed the serving certificate,
+// routes re-encrypting traffic to the gateway use it to validate the gateway.
+func (r *GateServerReconciler) servingCA(ctx context.Context, s *kubegatewayv1beta1.GateServer) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: servingCertSecretName(s), Namespace: s.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret.Data["ca.crt"]), nil
+}
+
+// parseCertificate parses the first certificate in a PEM bundle
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// serviceCAProvider uses the OpenShift service-ca operator,
+// the service is annotated and the operator issues and renews the certificate.
+type serviceCAProvider struct{}
+
+func (p *serviceCAProvider) reconcile(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	return nil
+}
+
+func (p *serviceCAProvider) serviceAnnotations(s *kubegatewayv1beta1.GateServer) map[string]string {
+	return map[string]string{
+		"service.alpha.openshift.io/serving-cert-secret-name": servingCertSecretName(s),
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// certManagerCRD returns a CRD of a cert-manager resource, accepting any spec
+func certManagerCRD(kind string) *apiextensionsv1.CustomResourceDefinition {
+	plural := strings.ToLower(kind) + "s"
+	preserve := true
+
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s.%s", plural, certManagerGroupVersion.Group)},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: certManagerGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: kind, ListKind: kind + "List", Plural: plural, Singular: strings.ToLower(kind)},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    certManagerGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserve},
+				},
+			}},
+		},
+	}
+}
+
+var _ = Describe("GateServer serving certificate", func() {
+	table.DescribeTable("selects the certificate provider",
+		func(provider string, apis ClusterAPIs, name string) {
+			r := &GateServerReconciler{APIs: apis}
+			s := &kubegatewayv1beta1.GateServer{}
+			s.Spec.CertProvider = provider
+
+			Expect(r.certProviderName(s)).To(Equal(name))
+		},
+		table.Entry("the service-ca operator on OpenShift", "", ClusterAPIs{ServiceCA: true, CertManager: true}, certProviderServiceCA),
+		table.Entry("cert-manager without the service-ca operator", "", ClusterAPIs{CertManager: true}, certProviderCertManager),
+		table.Entry("a self-signed CA without a certificate API", "", ClusterAPIs{}, certProviderSelfSigned),
+		table.Entry("the provider set in the spec", certProviderSelfSigned, ClusterAPIs{ServiceCA: true}, certProviderSelfSigned),
+	)
+
+	It("renews certificates when a third of their validity is left", func() {
+		notBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		Expect(certRenewalTime(notBefore, notBefore.Add(90*time.Hour))).To(Equal(notBefore.Add(60 * time.Hour)))
+		Expect(needsRenewal(nil)).To(BeTrue())
+	})
+
+	It("issues the serving certificate using a self-signed CA", func() {
+		ctx := context.Background()
+		r := newGateServerReconciler()
+		s := newGateServer()
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "ServingCertificateReady")).To(BeTrue())
+		Expect(stored.Status.ServingCertExpiry).NotTo(BeNil())
+
+		ca := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: s.Name + "-ca"}}
+		Expect(getObject(s, ca)).To(Succeed())
+		caCert, err := parseCertificate(ca.Data[corev1.TLSCertKey])
+		Expect(err).NotTo(HaveOccurred())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: servingCertSecretName(s)}}
+		Expect(getObject(s, secret)).To(Succeed())
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.CheckSignatureFrom(caCert)).To(Succeed())
+		Expect(cert.DNSNames).To(Equal(servingDNSNames(s)))
+		Expect(cert.NotAfter.Unix()).To(Equal(stored.Status.ServingCertExpiry.Unix()))
+
+		// A changed route host is added to the certificate
+		stored.Spec.Route = "gateway.apps.example.com"
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: servingCertSecretName(s)}}
+		Expect(getObject(s, secret)).To(Succeed())
+		cert, err = parseCertificate(secret.Data[corev1.TLSCertKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.VerifyHostname("gateway.apps.example.com")).To(Succeed())
+		Expect(x509.NewCertPool().AppendCertsFromPEM(secret.Data["ca.crt"])).To(BeTrue())
+	})
+
+	It("requests the serving certificate from the service-ca operator", func() {
+		r := newGateServerReconciler()
+		r.APIs.ServiceCA = true
+		s := newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		service := &corev1.Service{}
+		Expect(getObject(s, service)).To(Succeed())
+		Expect(service.Annotations).To(HaveKeyWithValue("service.alpha.openshift.io/serving-cert-secret-name", servingCertSecretName(s)))
+
+		// The test environment runs no service-ca operator
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "ServingCertificateReady")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("Pending"))
+	})
+
+	It("requests the serving certificate from cert-manager", func() {
+		crds := []client.Object{certManagerCRD("Certificate"), certManagerCRD("Issuer")}
+		options := envtest.CRDInstallOptions{CRDs: crds}
+		_, err := envtest.InstallCRDs(testEnv.Config, options)
+		Expect(err).NotTo(HaveOccurred())
+		defer envtest.UninstallCRDs(testEnv.Config, options)
+
+		r := newGateServerReconciler()
+		r.APIs.CertManager = true
+		s := newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		issuer := &unstructured.Unstructured{}
+		issuer.SetGroupVersionKind(certManagerGroupVersion.WithKind("Issuer"))
+		issuer.SetName(s.Name + "-selfsigned")
+		Expect(getObject(s, issuer)).To(Succeed())
+
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(certManagerGroupVersion.WithKind("Certificate"))
+		Expect(getObject(s, certificate)).To(Succeed())
+
+		secretName, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName")
+		Expect(secretName).To(Equal(servingCertSecretName(s)))
+		issuerName, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "name")
+		Expect(issuerName).To(Equal(issuer.GetName()))
+		dnsNames, _, _ := unstructured.NestedStringSlice(certificate.Object, "spec", "dnsNames")
+		Expect(dnsNames).To(Equal(servingDNSNames(s)))
+	})
+})
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// ClusterRole creates a cluster role resource
+// Cluster scoped resources can not be owned by the server, they are labeled
+// with the server name and namespace instead.
+func (r *GateServerReconciler) ClusterRole(s *kubegatewayv1beta1.GateServer) (*rbacv1.ClusterRole, error) {
+	clusterrole := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   scopedName(s),
+			Labels: gateServerLabels(s),
+		},
+		Rules: policyRules(s),
+	}
+
+	return clusterrole, nil
+}
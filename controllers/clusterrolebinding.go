@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// ClusterRoleBinding creates a cluster role binding resource
+// Cluster scoped resources can not be owned by the server, they are labeled
+// with the server name and namespace instead.
+func (r *GateServerReconciler) ClusterRoleBinding(s *kubegatewayv1beta1.GateServer) (*rbacv1.ClusterRoleBinding, error) {
+	roleRef := rbacv1.RoleRef{
+		APIGroup: "rbac.authorization.k8s.io",
+		Kind:     "ClusterRole",
+		Name:     scopedName(s),
+	}
+	if s.Spec.ClusterRole != "" {
+		roleRef.Name = s.Spec.ClusterRole
+	}
+
+	clusterrolebinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   scopedName(s),
+			Labels: gateServerLabels(s),
+		},
+		Subjects: serviceAccountSubjects(s),
+		RoleRef:  roleRef,
+	}
+
+	return clusterrolebinding, nil
+}
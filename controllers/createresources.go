@@ -3,155 +3,96 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	ctrl "sigs.k8s.io/controller-runtime"
 
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
 )
 
-// CreateResources creates resources needed to run the gateway proxy
+// gateResource is one of the resources needed to run the gateway proxy
+type gateResource struct {
+	kind      string
+	reconcile func(ctx context.Context, s *kubegatewayv1beta1.GateServer) error
+}
+
+// ReconcileResources makes sure the resources needed to run the gateway proxy
+// exist and match the desired state derived from the GateServer spec:
 // - secrets
+// - JWKS config map
+// - token revocation list config map
+// - k8s API credentials (validated, owned by the user)
 // - service
+// - serving certificate (see certProvider)
 // - service account
 // - role
 // - rolebinding
-// - route (FIXME: requirs openshift)
-func (r *GateServerReconciler) CreateResources(ctx context.Context, gateserver *kubegatewayv1beta1.GateServer) (ctrl.Result, error) {
-	var err error
-
-	// Take time
-	t := metav1.Time{Time: time.Now()}
-
-	// Create the JWT secret
-	r.Log.Info("Create JWT secret.")
-	secret, _ := r.Secret(gateserver)
-	if err := r.Client.Create(ctx, secret); err != nil {
-		r.Log.Info("Failed to create service.", "err", err)
-
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "SecretCreated",
-			Status:             "False",
-			Reason:             "FailedCreateSecret",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
-
-		return ctrl.Result{}, nil
+// - role bindings in target namespaces, or cluster role binding (see reconcileScope)
+// - route, ingress or HTTPRoute (see exposeMode)
+// - deployment
+//
+// Missing resources are re-created, and drift in the fields owned by the
+// operator is reverted, on every reconcile pass.
+func (r *GateServerReconciler) ReconcileResources(ctx context.Context, gateserver *kubegatewayv1beta1.GateServer) error {
+	resources := []gateResource{
+		{kind: "Secret", reconcile: r.reconcileSecret},
+		{kind: "JWKS", reconcile: r.reconcileJWKS},
+		{kind: "RevokedTokens", reconcile: r.reconcileRevokedTokens},
+		{kind: "APISecret", reconcile: r.reconcileAPISecret},
+		{kind: "Service", reconcile: r.reconcileService},
+		{kind: "ServingCertificate", reconcile: r.reconcileServingCert},
+		{kind: "ServiceAccount", reconcile: r.reconcileServiceAccount},
+		{kind: "Role", reconcile: r.reconcileRole},
+		{kind: "RoleBinding", reconcile: r.reconcileRoleBinding},
+		{kind: "Scope", reconcile: r.reconcileScope},
+		{kind: "Exposure", reconcile: r.reconcileExposure},
+		{kind: "Deployment", reconcile: r.reconcileDeployment},
 	}
 
-	// Create the service and route
-	se, _ := r.Service(gateserver)
-	err = r.Client.Create(ctx, se)
-	if err != nil {
-		r.Log.Info("Failed to create service.", "err", err)
+	for _, resource := range resources {
+		if err := resource.reconcile(ctx, gateserver); err != nil {
+			r.Log.Info("Failed to reconcile resource.", "kind", resource.kind, "err", err)
 
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "ServiceCreated",
-			Status:             "False",
-			Reason:             "FailedCreateService",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
+			setServerCondition(gateserver, metav1.Condition{
+				Type:    fmt.Sprintf("%sReconciled", resource.kind),
+				Status:  metav1.ConditionFalse,
+				Reason:  fmt.Sprintf("Failed%sReconcile", resource.kind),
+				Message: fmt.Sprintf("%s", err),
+			})
 
-		return ctrl.Result{}, err
-	}
-
-	// Create the service account and roles
-	sa, _ := r.ServiceAccount(gateserver)
-	err = r.Client.Create(ctx, sa)
-	if err != nil {
-		r.Log.Info("Failed to create serviceaccount.", "err", err)
-
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "ServiceaccountCreated",
-			Status:             "False",
-			Reason:             "FailedCreateServiceaccount",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
+			return err
 		}
 
-		return ctrl.Result{}, err
+		// Clear a previous failure of this resource
+		removeServerCondition(gateserver, fmt.Sprintf("%sReconciled", resource.kind))
 	}
 
-	role, _ := r.Role(gateserver)
-	err = r.Client.Create(ctx, role)
-	if err != nil {
-		r.Log.Info("Failed to create role.", "err", err)
+	return nil
+}
 
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "RoleCreated",
-			Status:             "False",
-			Reason:             "FailedCreateRole",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
+// setServerCondition sets a condition on the GateServer status, the transition
+// time is only updated when the condition status changes.
+func setServerCondition(gateserver *kubegatewayv1beta1.GateServer, condition metav1.Condition) {
+	condition.ObservedGeneration = gateserver.Generation
+	meta.SetStatusCondition(&gateserver.Status.Conditions, condition)
+}
 
-		return ctrl.Result{}, err
+// removeServerCondition removes a condition from the GateServer status if it is set,
+// meta.RemoveStatusCondition can not remove a condition from an empty list.
+func removeServerCondition(gateserver *kubegatewayv1beta1.GateServer, conditionType string) {
+	if meta.FindStatusCondition(gateserver.Status.Conditions, conditionType) != nil {
+		meta.RemoveStatusCondition(&gateserver.Status.Conditions, conditionType)
 	}
+}
 
-	rolebinding, _ := r.RoleBinding(gateserver)
-	err = r.Client.Create(ctx, rolebinding)
-	if err != nil {
-		r.Log.Info("Failed to create rolebinding.", "err", err)
-
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "RolebindingCreated",
-			Status:             "False",
-			Reason:             "FailedCreateRolebinding",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
-
-		return ctrl.Result{}, err
+// mergeLabels adds the desired labels to the labels of an existing object
+func mergeLabels(existing map[string]string, desired map[string]string) map[string]string {
+	if existing == nil {
+		existing = map[string]string{}
 	}
-
-	route, _ := r.Route(gateserver)
-	err = r.Client.Create(ctx, route)
-	if err != nil {
-		r.Log.Info("Failed to create route.", "err", err)
-
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "RouteCreated",
-			Status:             "False",
-			Reason:             "FailedCreateRoute",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
-
-		return ctrl.Result{}, nil
+	for k, v := range desired {
+		existing[k] = v
 	}
 
-	return ctrl.Result{}, nil
+	return existing
 }
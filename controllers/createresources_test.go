@@ -0,0 +1,101 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer resources", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("creates the gateway resources and records the reconciled generation", func() {
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controllerutil.ContainsFinalizer(stored, gateserverFinalizer)).To(BeTrue())
+		Expect(stored.Status.ObservedGeneration).To(Equal(stored.Generation))
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "Reconciled")).To(BeTrue())
+
+		Expect(getObject(s, &corev1.ServiceAccount{})).To(Succeed())
+		Expect(getObject(s, &corev1.Service{})).To(Succeed())
+		Expect(getObject(s, &rbacv1.Role{})).To(Succeed())
+		Expect(getObject(s, &rbacv1.RoleBinding{})).To(Succeed())
+		Expect(getObject(s, &appsv1.Deployment{})).To(Succeed())
+		Expect(getObject(s, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: jwtSecretName(s)}})).To(Succeed())
+	})
+
+	It("reverts changes to the gateway deployment", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(getObject(s, deployment)).To(Succeed())
+		deployment.Spec.Template.Spec.Containers[0].Image = "quay.io/example/other:latest"
+		Expect(k8sClient.Update(context.Background(), deployment)).To(Succeed())
+
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		deployment = &appsv1.Deployment{}
+		Expect(getObject(s, deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal(s.Spec.IMG))
+	})
+
+	It("re-creates deleted gateway resources", func() {
+		Expect(k8sClient.Delete(context.Background(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace}})).To(Succeed())
+		Expect(k8sClient.Delete(context.Background(), &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace}})).To(Succeed())
+
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getObject(s, &corev1.Service{})).To(Succeed())
+		Expect(getObject(s, &rbacv1.Role{})).To(Succeed())
+	})
+
+	It("reverts changes to the gateway role rules", func() {
+		role := &rbacv1.Role{}
+		Expect(getObject(s, role)).To(Succeed())
+		rules := role.Rules
+		role.Rules = []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}}
+		Expect(k8sClient.Update(context.Background(), role)).To(Succeed())
+
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		role = &rbacv1.Role{}
+		Expect(getObject(s, role)).To(Succeed())
+		Expect(role.Rules).To(Equal(rules))
+	})
+})
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -11,10 +13,32 @@ import (
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
 )
 
+// Default k8s API server and the service account credentials mounted in the gateway pod
+const (
+	defaultAPIURL        = "https://kubernetes.default.svc"
+	serviceAccountCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	serviceAccountToken  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	apiSecretMountPath   = "/var/run/secrets/api-server"
+)
+
 // Deployment creates a deployment resource
 func (r *GateServerReconciler) Deployment(s *kubegatewayv1beta1.GateServer) (*appsv1.Deployment, error) {
 	image := s.Spec.IMG
 	replicas := int32(1)
+	secretMode := int32(0644)
+
+	// Proxy the k8s API set in the spec, using the credentials secret if set
+	apiURL := s.Spec.APIURL
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+	caFile := serviceAccountCAFile
+	tokenFile := serviceAccountToken
+	if s.Spec.APISecret != "" {
+		caFile = fmt.Sprintf("%s/ca.crt", apiSecretMountPath)
+		tokenFile = fmt.Sprintf("%s/token", apiSecretMountPath)
+	}
+	signingKey := signingSecretOf(s)
 	labels := map[string]string{
 		"app": s.Name,
 	}
@@ -45,6 +69,7 @@ func (r *GateServerReconciler) Deployment(s *kubegatewayv1beta1.GateServer) (*ap
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: 8080,
 							Name:          "https",
+							Protocol:      corev1.ProtocolTCP,
 						}},
 						VolumeMounts: []corev1.VolumeMount{
 							{
@@ -54,16 +79,16 @@ func (r *GateServerReconciler) Deployment(s *kubegatewayv1beta1.GateServer) (*ap
 						},
 						Command: []string{
 							"./kube-gateway",
-							"-api-server=https://kubernetes.default.svc",
+							fmt.Sprintf("-api-server=%s", apiURL),
 							"-gateway-listen=https://0.0.0.0:8080",
-							"-api-server-ca-file=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
-							"-api-server-bearer-token-file=/var/run/secrets/kubernetes.io/serviceaccount/token",
+							fmt.Sprintf("-api-server-ca-file=%s", caFile),
+							fmt.Sprintf("-api-server-bearer-token-file=%s", tokenFile),
 							"-gateway-key-file=/var/run/secrets/serving-cert/tls.key",
 							"-gateway-cert-file=/var/run/secrets/serving-cert/tls.crt",
-							fmt.Sprintf("-jwt-public-key-name=%s-jwt-secret", s.Name),
+							fmt.Sprintf("-jwt-public-key-name=%s", signingKey.name),
 							fmt.Sprintf("-jwt-public-key-namespace=%s", s.Namespace),
 							"-jwt-request-enable=true",
-							fmt.Sprintf("-jwt-private-key-name=%s-jwt-secret", s.Name),
+							fmt.Sprintf("-jwt-private-key-name=%s", signingKey.name),
 							fmt.Sprintf("-jwt-private-key-namespace=%s", s.Namespace),
 						},
 					}},
@@ -73,7 +98,8 @@ func (r *GateServerReconciler) Deployment(s *kubegatewayv1beta1.GateServer) (*ap
 							Name: "serving-cert",
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
-									SecretName: fmt.Sprintf("%s-secret", s.Name),
+									SecretName:  servingCertSecretName(s),
+									DefaultMode: &secretMode,
 								},
 							},
 						},
@@ -85,7 +111,192 @@ func (r *GateServerReconciler) Deployment(s *kubegatewayv1beta1.GateServer) (*ap
 		},
 	}
 
+	// Secret entries of a user supplied signing key, tokens can not be issued
+	// by the gateway when the private key is held by an external signer, or
+	// by older gateways when the private key is not in the default entry
+	container := &deployment.Spec.Template.Spec.Containers[0]
+	extended := extendedGateway(s)
+	switch {
+	case signingKey.keyFile == "" || (signingKey.keyFile != defaultSigningKeyFile && !extended):
+		container.Command = removeArgs(container.Command, "-jwt-request-enable=", "-jwt-private-key-name=", "-jwt-private-key-namespace=")
+		container.Command = append(container.Command, "-jwt-request-enable=false")
+	case signingKey.keyFile != defaultSigningKeyFile:
+		container.Command = append(container.Command, fmt.Sprintf("-jwt-private-key-file=%s", signingKey.keyFile))
+	}
+	// The gateway verifies tokens using the public keys, generated secrets publish them
+	// in a dedicated entry, and the matching certificates in the certificate entry.
+	// Older gateways read the certificate entry, the active key certificate first.
+	if signingKey.publicKeysFile != defaultSigningCertFile {
+		if extended {
+			container.Command = append(container.Command, fmt.Sprintf("-jwt-public-key-file=%s", signingKey.publicKeysFile))
+		} else if signingKey.certFile != defaultSigningCertFile {
+			return nil, fmt.Errorf("signing key entry %s requires kube-gateway %s or later, image %q, set the version of the image using the %s annotation",
+				signingKey.certFile, minExtendedGatewayVersion, s.Spec.IMG, gatewayVersionAnnotation)
+		}
+	}
+
+	// Revoked tokens are rejected, updates of the revocation list are synced to the mounted file without a restart
+	podSpec := &deployment.Spec.Template.Spec
+	if extended {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "revoked-tokens",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: revokedTokensConfigMapName(s)},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "revoked-tokens",
+			MountPath: revokedTokensMountPath,
+			ReadOnly:  true,
+		})
+		container.Command = append(container.Command, fmt.Sprintf("-jwt-revoked-tokens-file=%s/%s", revokedTokensMountPath, revokedTokensFile))
+	}
+
+	// Tokens signed for another gate server are rejected, the audience is the route host
+	// whatever host the gateway is reached through
+	if extended {
+		container.Command = append(container.Command, fmt.Sprintf("-jwt-issuer=%s", tokenIssuer(s)))
+		if s.Spec.Route != "" {
+			container.Command = append(container.Command, fmt.Sprintf("-jwt-audience=%s", s.Spec.Route))
+		}
+	}
+
+	if s.Spec.APISecret != "" {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "api-server",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  s.Spec.APISecret,
+					DefaultMode: &secretMode,
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "api-server",
+			MountPath: apiSecretMountPath,
+		})
+	}
+
 	controllerutil.SetControllerReference(s, deployment, r.Scheme)
 
 	return deployment, nil
 }
+
+// reconcileDeployment makes sure the deployment exists and matches the desired state,
+// only fields set by the operator are compared, fields defaulted by the cluster are kept.
+func (r *GateServerReconciler) reconcileDeployment(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.Deployment(s)
+	if err != nil {
+		return err
+	}
+
+	// Restart the gateway pods when the serving certificate is renewed
+	certHash, err := r.servingCertHash(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	// Restart the gateway pods when the k8s API credentials change
+	apiHash, err := r.apiSecretHash(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	// Restart the gateway pods when the JWT signing key is rotated
+	keysHash, err := r.signingKeysHash(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Labels = mergeLabels(deployment.Labels, desired.Labels)
+		deployment.Spec.Replicas = desired.Spec.Replicas
+
+		// Selector is immutable, set it only on creation
+		if deployment.Spec.Selector == nil {
+			deployment.Spec.Selector = desired.Spec.Selector
+		}
+
+		template := &deployment.Spec.Template
+		template.Labels = mergeLabels(template.Labels, desired.Spec.Template.Labels)
+		template.Annotations = mergeLabels(template.Annotations, map[string]string{
+			"kubegateway.kubevirt.io/serving-cert-hash": certHash,
+			"kubegateway.kubevirt.io/api-secret-hash":   apiHash,
+			"kubegateway.kubevirt.io/jwt-keys-hash":     keysHash,
+		})
+		template.Spec.ServiceAccountName = desired.Spec.Template.Spec.ServiceAccountName
+		template.Spec.Volumes = desired.Spec.Template.Spec.Volumes
+		template.Spec.Containers = mergeContainers(template.Spec.Containers, desired.Spec.Template.Spec.Containers)
+
+		return controllerutil.SetControllerReference(s, deployment, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Older gateway images do not check the issuer and the audience of the tokens
+	if extendedGateway(s) {
+		setServerCondition(s, metav1.Condition{
+			Type:    "AudienceEnforced",
+			Status:  metav1.ConditionTrue,
+			Reason:  "IssuerAudienceChecked",
+			Message: "The gateway rejects tokens signed for another gate server",
+		})
+	} else {
+		setServerCondition(s, metav1.Condition{
+			Type:   "AudienceEnforced",
+			Status: metav1.ConditionFalse,
+			Reason: "GatewayVersionUnsupported",
+			Message: fmt.Sprintf("The gateway image does not check the token iss and aud claims, tokens signed for another gate server "+
+				"using the same signing key are accepted. The checks require kube-gateway %s or later, set the %s annotation when "+
+				"the image tag is not a version", minExtendedGatewayVersion, gatewayVersionAnnotation),
+		})
+	}
+
+	return nil
+}
+
+// mergeContainers sets the fields managed by the operator on the existing containers,
+// containers are matched by name.
+func mergeContainers(existing []corev1.Container, desired []corev1.Container) []corev1.Container {
+	containers := make([]corev1.Container, 0, len(desired))
+
+	for _, d := range desired {
+		c := d
+		for _, e := range existing {
+			if e.Name == d.Name {
+				c = e
+				c.Image = d.Image
+				c.Command = d.Command
+				c.Args = d.Args
+				c.Env = d.Env
+				c.Ports = d.Ports
+				c.VolumeMounts = d.VolumeMounts
+			}
+		}
+		containers = append(containers, c)
+	}
+
+	return containers
+}
+
+// removeArgs removes the arguments starting with one of the prefixes
+func removeArgs(args []string, prefixes ...string) []string {
+	filtered := []string{}
+	for _, arg := range args {
+		keep := true
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(arg, prefix) {
+				keep = false
+			}
+		}
+		if keep {
+			filtered = append(filtered, arg)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// gatewayFlags returns the gateway command flags of the server deployment, by flag name
+func gatewayFlags(s *kubegatewayv1beta1.GateServer) map[string]string {
+	r := &GateServerReconciler{Scheme: runtime.NewScheme()}
+	deployment, err := r.Deployment(s)
+	Expect(err).NotTo(HaveOccurred())
+
+	flags := map[string]string{}
+	for _, arg := range deployment.Spec.Template.Spec.Containers[0].Command[1:] {
+		parts := strings.SplitN(arg, "=", 2)
+		flags[parts[0]] = parts[len(parts)-1]
+	}
+	return flags
+}
+
+// newDeploymentServer returns a GateServer running the given gateway image, without creating it
+func newDeploymentServer(img string) *kubegatewayv1beta1.GateServer {
+	s := &kubegatewayv1beta1.GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: "ns"}}
+	s.Spec.IMG = img
+	s.Spec.Route = "gateway.example.com"
+	return s
+}
+
+var _ = Describe("Gateway deployment", func() {
+	// Flags defined only by newer gateways
+	extendedFlags := []string{"-jwt-public-key-file", "-jwt-revoked-tokens-file", "-jwt-issuer", "-jwt-audience"}
+
+	table.DescribeTable("passes the flags defined by the gateway image version",
+		func(img string, annotation string, extended bool) {
+			s := newDeploymentServer(img)
+			if annotation != "" {
+				s.Annotations = map[string]string{gatewayVersionAnnotation: annotation}
+			}
+
+			flags := gatewayFlags(s)
+			for _, flag := range extendedFlags {
+				_, ok := flags[flag]
+				Expect(ok).To(Equal(extended), "flag %s", flag)
+			}
+		},
+		table.Entry("the latest tag", "quay.io/kubevirt-ui/kube-gateway:latest", "", false),
+		table.Entry("a digest", "quay.io/kubevirt-ui/kube-gateway@sha256:1234", "", false),
+		table.Entry("an older version", "quay.io/kubevirt-ui/kube-gateway:v0.1.0", "", false),
+		table.Entry("the first extended version", "quay.io/kubevirt-ui/kube-gateway:v0.2.0", "", true),
+		table.Entry("a version without the v prefix", "registry:5000/kube-gateway:0.3.1", "", true),
+		table.Entry("a version set by the annotation", "quay.io/kubevirt-ui/kube-gateway:latest", "v0.2.0", true),
+	)
+
+	It("disables token requests when an older gateway can not read the private key entry", func() {
+		s := newDeploymentServer("quay.io/kubevirt-ui/kube-gateway:latest")
+		s.Spec.SigningKey = &kubegatewayv1beta1.SigningKeyRef{Name: "pki-signing-key", KeyFile: "signing.key"}
+
+		flags := gatewayFlags(s)
+		Expect(flags).NotTo(HaveKey("-jwt-private-key-file"))
+		Expect(flags).To(HaveKeyWithValue("-jwt-request-enable", "false"))
+
+		// A certificate entry the gateway can not read is an error
+		s.Spec.SigningKey.CertFile = "signing.crt"
+		r := &GateServerReconciler{Scheme: runtime.NewScheme()}
+		_, err := r.Deployment(s)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// ClusterAPIs lists the optional APIs served by the cluster
+type ClusterAPIs struct {
+	// Route is true when the OpenShift route API is served
+	Route bool
+
+	// Ingress is true when the networking.k8s.io/v1 ingress API is served
+	Ingress bool
+
+	// ServiceCA is true when the OpenShift service-ca operator is installed
+	ServiceCA bool
+
+	// CertManager is true when the cert-manager certificate API is served
+	CertManager bool
+
+	// OAuthClient is true when the OpenShift oauth client API is served
+	OAuthClient bool
+
+	// HTTPRoute is the group version of the Gateway API HTTPRoute resource,
+	// empty when the Gateway API is not served
+	HTTPRoute schema.GroupVersion
+
+	// BackendTLSPolicy is the group version of the Gateway API BackendTLSPolicy resource,
+	// empty when it is not served
+	BackendTLSPolicy schema.GroupVersion
+}
+
+// DiscoverClusterAPIs uses API discovery to find which optional APIs are served by the cluster
+func DiscoverClusterAPIs(cfg *rest.Config) (ClusterAPIs, error) {
+	apis := ClusterAPIs{}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return apis, err
+	}
+
+	if apis.Route, err = servesResource(dc, "route.openshift.io/v1", "routes"); err != nil {
+		return apis, err
+	}
+	if apis.Ingress, err = servesResource(dc, "networking.k8s.io/v1", "ingresses"); err != nil {
+		return apis, err
+	}
+	if apis.ServiceCA, err = servesResource(dc, "operator.openshift.io/v1", "servicecas"); err != nil {
+		return apis, err
+	}
+	if apis.CertManager, err = servesResource(dc, "cert-manager.io/v1", "certificates"); err != nil {
+		return apis, err
+	}
+	if apis.OAuthClient, err = servesResource(dc, "oauth.openshift.io/v1", "oauthclients"); err != nil {
+		return apis, err
+	}
+	for _, gv := range []string{"gateway.networking.k8s.io/v1", "gateway.networking.k8s.io/v1beta1"} {
+		found, err := servesResource(dc, gv, "httproutes")
+		if err != nil {
+			return apis, err
+		}
+		if found {
+			apis.HTTPRoute, _ = schema.ParseGroupVersion(gv)
+			break
+		}
+	}
+
+	for _, gv := range []string{"gateway.networking.k8s.io/v1", "gateway.networking.k8s.io/v1alpha3"} {
+		found, err := servesResource(dc, gv, "backendtlspolicies")
+		if err != nil {
+			return apis, err
+		}
+		if found {
+			apis.BackendTLSPolicy, _ = schema.ParseGroupVersion(gv)
+			break
+		}
+	}
+
+	return apis, nil
+}
+
+// servesResource checks if a resource is served in a group version
+func servesResource(dc discovery.DiscoveryInterface, groupVersion string, resource string) (bool, error) {
+	resources, err := dc.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
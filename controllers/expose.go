@@ -0,0 +1,158 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Exposure modes
+const (
+	exposeRoute     = "Route"
+	exposeIngress   = "Ingress"
+	exposeHTTPRoute = "HTTPRoute"
+	exposeNone      = "None"
+)
+
+// exposeMode returns the exposure mode of the server, when not set in the spec
+// the mode is detected using the APIs served by the cluster.
+func (r *GateServerReconciler) exposeMode(s *kubegatewayv1beta1.GateServer) string {
+	if s.Spec.Expose != "" {
+		return s.Spec.Expose
+	}
+
+	switch {
+	case r.APIs.Route:
+		return exposeRoute
+	case r.APIs.Ingress:
+		return exposeIngress
+	default:
+		return exposeNone
+	}
+}
+
+// reconcileExposure exposes the gate proxy server outside the cluster using the
+// selected exposure mode, and removes resources left over from other modes.
+func (r *GateServerReconciler) reconcileExposure(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	mode := r.exposeMode(s)
+
+	var err error
+	switch mode {
+	case exposeRoute:
+		err = r.reconcileRoute(ctx, s)
+	case exposeIngress:
+		err = r.reconcileIngress(ctx, s)
+	case exposeHTTPRoute:
+		err = r.reconcileHTTPRoute(ctx, s)
+	}
+	if err != nil {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Exposed",
+			Status:  metav1.ConditionFalse,
+			Reason:  fmt.Sprintf("Failed%s", mode),
+			Message: fmt.Sprintf("%s", err),
+		})
+		return err
+	}
+
+	// Remove resources of other exposure modes
+	if mode != exposeRoute && r.APIs.Route {
+		if err := r.deleteOwned(ctx, s, &routev1.Route{}); err != nil {
+			return err
+		}
+	}
+	if mode != exposeIngress && r.APIs.Ingress {
+		if err := r.deleteOwned(ctx, s, &networkingv1.Ingress{}); err != nil {
+			return err
+		}
+	}
+	if mode != exposeHTTPRoute && !r.APIs.HTTPRoute.Empty() {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(r.APIs.HTTPRoute.WithKind("HTTPRoute"))
+		if err := r.deleteOwned(ctx, s, route); err != nil {
+			return err
+		}
+	}
+	if mode != exposeHTTPRoute && !r.APIs.BackendTLSPolicy.Empty() {
+		policy := &unstructured.Unstructured{}
+		policy.SetGroupVersionKind(r.APIs.BackendTLSPolicy.WithKind("BackendTLSPolicy"))
+		if err := r.deleteOwned(ctx, s, policy); err != nil {
+			return err
+		}
+		configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: servingCAConfigMapName(s)}}
+		if err := r.deleteOwned(ctx, s, configmap); err != nil {
+			return err
+		}
+	}
+
+	if mode == exposeNone {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Exposed",
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotExposed",
+			Message: "Gate proxy server is not exposed outside the cluster",
+		})
+		return nil
+	}
+
+	setServerCondition(s, metav1.Condition{
+		Type:    "Exposed",
+		Status:  metav1.ConditionTrue,
+		Reason:  fmt.Sprintf("%sReady", mode),
+		Message: fmt.Sprintf("Gate proxy server is exposed at %s using %s", s.Spec.Route, mode),
+	})
+
+	return nil
+}
+
+// deleteOwned deletes an object if it is controlled by the server, objects
+// without a name are assumed to be named after the server.
+func (r *GateServerReconciler) deleteOwned(ctx context.Context, s *kubegatewayv1beta1.GateServer, obj client.Object) error {
+	name := obj.GetName()
+	if name == "" {
+		name = s.Name
+	}
+
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: s.Namespace}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(obj, s) {
+		return nil
+	}
+
+	r.Log.Info("Delete unused resource.", "name", obj.GetName())
+	if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
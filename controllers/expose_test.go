@@ -0,0 +1,125 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer exposure", func() {
+	table.DescribeTable("selects the exposure mode",
+		func(expose string, apis ClusterAPIs, mode string) {
+			r := &GateServerReconciler{APIs: apis}
+			s := &kubegatewayv1beta1.GateServer{}
+			s.Spec.Expose = expose
+
+			Expect(r.exposeMode(s)).To(Equal(mode))
+		},
+		table.Entry("a route on OpenShift", "", ClusterAPIs{Route: true, Ingress: true}, exposeRoute),
+		table.Entry("an ingress without routes", "", ClusterAPIs{Ingress: true}, exposeIngress),
+		table.Entry("none without routes and ingresses", "", ClusterAPIs{}, exposeNone),
+		table.Entry("the mode set in the spec", exposeHTTPRoute, ClusterAPIs{Route: true}, exposeHTTPRoute),
+	)
+
+	It("discovers the APIs served by the cluster", func() {
+		apis, err := DiscoverClusterAPIs(testEnv.Config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apis.Ingress).To(BeTrue())
+		Expect(apis.Route).To(BeFalse())
+		Expect(apis.HTTPRoute.Empty()).To(BeTrue())
+	})
+
+	It("exposes the server using an ingress, and removes it when no longer exposed", func() {
+		ctx := context.Background()
+		r := newGateServerReconciler()
+		r.APIs.Ingress = true
+		s := newGateServer()
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "Exposed")).To(BeTrue())
+
+		ingress := &networkingv1.Ingress{}
+		Expect(getObject(s, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules[0].Host).To(Equal(s.Spec.Route))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal(s.Name))
+		Expect(ingress.Spec.TLS[0].SecretName).To(Equal(servingCertSecretName(s)))
+		Expect(metav1.IsControlledBy(ingress, stored)).To(BeTrue())
+
+		stored.Spec.Expose = exposeNone
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+
+		stored, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "Exposed")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("NotExposed"))
+
+		err = getObject(s, &networkingv1.Ingress{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports an HTTPRoute exposure when the Gateway API is not served", func() {
+		ctx := context.Background()
+		r := newGateServerReconciler()
+		s := newGateServer()
+		s.Spec.Expose = exposeHTTPRoute
+		s.Spec.GatewayName = "example-gateway"
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).To(HaveOccurred())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "Exposed")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("FailedHTTPRoute"))
+	})
+
+	It("attaches the HTTPRoute to the gateway set in the spec", func() {
+		r := newGateServerReconciler()
+		r.APIs.HTTPRoute = schema.GroupVersion{Group: "gateway.networking.k8s.io", Version: "v1"}
+		r.APIs.BackendTLSPolicy = schema.GroupVersion{Group: "gateway.networking.k8s.io", Version: "v1alpha3"}
+		s := newGateServer()
+		s.Spec.GatewayName = "example-gateway"
+		s.Spec.GatewayNamespace = "gateways"
+
+		route, err := r.HTTPRoute(s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.GetKind()).To(Equal("HTTPRoute"))
+
+		spec := route.Object["spec"].(map[string]interface{})
+		Expect(spec["hostnames"]).To(Equal([]interface{}{s.Spec.Route}))
+		Expect(spec["parentRefs"]).To(Equal([]interface{}{
+			map[string]interface{}{"name": "example-gateway", "namespace": "gateways"},
+		}))
+	})
+})
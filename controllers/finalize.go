@@ -0,0 +1,124 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// finalizeGateServer deletes the resources created by the server that can not be
+// garbage collected using owner references, e.g. cluster roles, cluster role bindings,
+// oauth clients and role bindings in other namespaces.
+// The CleanedUp condition reports the cleanup progress, the server finalizer
+// is removed only when all the resources are gone.
+func (r *GateServerReconciler) finalizeGateServer(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	remaining, err := r.deleteLabeledResources(ctx, s)
+	if err != nil {
+		setServerCondition(s, metav1.Condition{
+			Type:    "CleanedUp",
+			Status:  metav1.ConditionFalse,
+			Reason:  "CleanupFailed",
+			Message: err.Error(),
+		})
+		if err := r.Status().Update(ctx, s); err != nil {
+			r.Log.Info("Failed to update status", "err", err)
+		}
+
+		return err
+	}
+
+	if remaining > 0 {
+		setServerCondition(s, metav1.Condition{
+			Type:    "CleanedUp",
+			Status:  metav1.ConditionFalse,
+			Reason:  "CleanupInProgress",
+			Message: fmt.Sprintf("Waiting for %d resources to be deleted", remaining),
+		})
+		if err := r.Status().Update(ctx, s); err != nil {
+			r.Log.Info("Failed to update status", "err", err)
+		}
+
+		return fmt.Errorf("waiting for %d resources to be deleted", remaining)
+	}
+
+	r.Log.Info("Successfully finalized gateserver")
+	return nil
+}
+
+// deleteLabeledResources deletes all the resources labeled as created by the server,
+// and returns the number of resources that are still being deleted.
+func (r *GateServerReconciler) deleteLabeledResources(ctx context.Context, s *kubegatewayv1beta1.GateServer) (int, error) {
+	lists := []client.ObjectList{
+		&rbacv1.RoleBindingList{},
+		&rbacv1.RoleList{},
+		&rbacv1.ClusterRoleBindingList{},
+		&rbacv1.ClusterRoleList{},
+	}
+	if r.APIs.OAuthClient {
+		oauthclients := &unstructured.UnstructuredList{}
+		oauthclients.SetAPIVersion("oauth.openshift.io/v1")
+		oauthclients.SetKind("OAuthClientList")
+		lists = append(lists, oauthclients)
+	}
+
+	remaining := 0
+	for _, list := range lists {
+		if err := r.List(ctx, list, gateServerSelector(s)); err != nil {
+			return remaining, err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return remaining, err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+
+			remaining++
+			if obj.GetDeletionTimestamp() != nil {
+				continue
+			}
+
+			r.Log.Info("Delete resource created by gateserver.", "name", obj.GetName(), "namespace", obj.GetNamespace())
+			err := r.Delete(ctx, obj)
+			if err != nil && !errors.IsNotFound(err) {
+				return remaining, fmt.Errorf("failed to delete %s: %w", obj.GetName(), err)
+			}
+			if err == nil && len(obj.GetFinalizers()) > 0 {
+				continue
+			}
+
+			remaining--
+		}
+	}
+
+	return remaining, nil
+}
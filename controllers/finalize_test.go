@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer cleanup", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+	var target string
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		target = createNamespace()
+		s.Spec.TargetNamespaces = []string{target}
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// labeledResources returns the number of resources labeled as created by the server
+	labeledResources := func() int {
+		count := 0
+		for _, list := range []client.ObjectList{&rbacv1.RoleBindingList{}, &rbacv1.RoleList{}, &rbacv1.ClusterRoleBindingList{}, &rbacv1.ClusterRoleList{}} {
+			Expect(k8sClient.List(context.Background(), list, gateServerSelector(s))).To(Succeed())
+			count += meta.LenList(list)
+		}
+		return count
+	}
+
+	It("deletes the resources created outside the server namespace", func() {
+		ctx := context.Background()
+		Expect(labeledResources()).To(Equal(2))
+
+		Expect(k8sClient.Delete(ctx, s)).To(Succeed())
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(s)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(labeledResources()).To(Equal(0))
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(s), &kubegatewayv1beta1.GateServer{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("deletes the cluster role and cluster role binding of the Cluster scope", func() {
+		ctx := context.Background()
+		stored := &kubegatewayv1beta1.GateServer{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(s), stored)).To(Succeed())
+		stored.Spec.Scope = scopeCluster
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labeledResources()).To(Equal(2))
+
+		Expect(k8sClient.Delete(ctx, s)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(s)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(labeledResources()).To(Equal(0))
+	})
+
+	It("keeps the server until the resources are gone, and reports the progress", func() {
+		ctx := context.Background()
+
+		// A finalizer of another controller holds the role binding
+		rolebinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: scopedName(s), Namespace: target}}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		controllerutil.AddFinalizer(rolebinding, "example.com/hold")
+		Expect(k8sClient.Update(ctx, rolebinding)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, s)).To(Succeed())
+		stored, err := reconcileServer(r, s)
+		Expect(err).To(HaveOccurred())
+		Expect(controllerutil.ContainsFinalizer(stored, gateserverFinalizer)).To(BeTrue())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "CleanedUp")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("CleanupInProgress"))
+
+		rolebinding = &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: scopedName(s), Namespace: target}}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		controllerutil.RemoveFinalizer(rolebinding, "example.com/hold")
+		Expect(k8sClient.Update(ctx, rolebinding)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(s)})
+		Expect(err).NotTo(HaveOccurred())
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(s), &kubegatewayv1beta1.GateServer{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -18,40 +18,61 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
 )
 
 const gateserverFinalizer = "kubegateway.kubevirt.io/finalizer"
 
+// healthRequeueInterval is the time to wait before checking again a gateway that is not ready
+const healthRequeueInterval = 30 * time.Second
+
+// externalSignerSyncInterval is the time to wait before reading again the external signer public keys
+const externalSignerSyncInterval = 10 * time.Minute
+
 // GateServerReconciler reconciles a GateServer object
 type GateServerReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// APIs lists the optional APIs served by the cluster
+	APIs ClusterAPIs
 }
 
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=roles,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=clusterroles,verbs=get;list;watch;create;update;patch;delete;deletecollection
+// +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=clusterroles,verbs=get;list;watch;create;update;patch;delete;deletecollection;bind
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=clusterrolebindings,verbs=get;list;watch;create;update;patch;delete;deletecollection
 // +kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="route.openshift.io",resources=routes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="route.openshift.io",resources=routes/custom-host,verbs=create;patch
+// +kubebuilder:rbac:groups="cert-manager.io",resources=certificates;issuers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="gateway.networking.k8s.io",resources=httproutes;backendtlspolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="oauth.openshift.io",resources=oauthclients,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="security.openshift.io",resources=securitycontextconstraints,resourceNames=privileged,verbs=use
 // +kubebuilder:rbac:groups="kubegateway.kubevirt.io",resources=gateservers,verbs=get;list;watch;create;update;patch;delete
@@ -61,10 +82,9 @@ type GateServerReconciler struct {
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the GateServer object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// The state specified by the GateServer object is compared against the actual
+// cluster state on every pass, resources that are missing or drifted from the
+// desired state are created or updated.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.0/pkg/reconcile
@@ -97,7 +117,7 @@ func (r *GateServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			// Run finalization logic for gateserverFinalizer. If the
 			// finalization logic fails, don't remove the finalizer so
 			// that we can retry during the next reconciliation.
-			if err := r.finalizeGateServer(gateserver); err != nil {
+			if err := r.finalizeGateServer(ctx, gateserver); err != nil {
 				return ctrl.Result{}, err
 			}
 
@@ -112,42 +132,6 @@ func (r *GateServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	// If token was created, exit.
-	if gateserver.Status.Phase != "" {
-		r.Log.Info("Old server", "id", gateserver.Name)
-		return ctrl.Result{}, nil
-	}
-
-	// Take time
-	t := metav1.Time{Time: time.Now()}
-
-	ctr, err := r.CreateResources(ctx, gateserver)
-	if err != nil {
-		return ctr, nil
-	}
-
-	// Create the gate service
-	dep, _ := r.Deployment(gateserver)
-	err = r.Client.Create(ctx, dep)
-	if err != nil {
-		r.Log.Info("Failed to create deployment.", "err", err)
-
-		gateserver.Status.Phase = "Error"
-		condition := metav1.Condition{
-			Type:               "DeploymentCreated",
-			Status:             "False",
-			Reason:             "FailedCreateDeployment",
-			Message:            fmt.Sprintf("%s", err),
-			LastTransitionTime: t,
-		}
-		gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
-		if err := r.Status().Update(ctx, gateserver); err != nil {
-			r.Log.Info("Failed to update status", "err", err)
-		}
-
-		return ctrl.Result{}, nil
-	}
-
 	// Add finalizer for this CR
 	if !controllerutil.ContainsFinalizer(gateserver, gateserverFinalizer) {
 		controllerutil.AddFinalizer(gateserver, gateserverFinalizer)
@@ -157,34 +141,176 @@ func (r *GateServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
-	gateserver.Status.Phase = "Ready"
-	condition := metav1.Condition{
-		Type:               "Created",
-		Status:             "True",
-		Reason:             "AllResourcesCreated",
-		Message:            "All resources created",
-		LastTransitionTime: t,
+	// Compare the desired state with the cluster state and converge it,
+	// this runs on every pass so missing or edited resources are repaired.
+	if err := r.ReconcileResources(ctx, gateserver); err != nil {
+		gateserver.Status.Phase = phaseError
+		setServerCondition(gateserver, metav1.Condition{
+			Type:    "Reconciled",
+			Status:  metav1.ConditionFalse,
+			Reason:  "FailedReconcile",
+			Message: "Failed to reconcile resources",
+		})
+		if err := r.Status().Update(ctx, gateserver); err != nil {
+			r.Log.Info("Failed to update status", "err", err)
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	gateserver.Status.ObservedGeneration = gateserver.Generation
+	setServerCondition(gateserver, metav1.Condition{
+		Type:    "Reconciled",
+		Status:  metav1.ConditionTrue,
+		Reason:  "AllResourcesReconciled",
+		Message: "All resources reconciled",
+	})
+
+	// Report the gateway health, the phase is Ready only when gateway pods are serving
+	if err := r.updateHealth(ctx, gateserver); err != nil {
+		r.Log.Info("Failed to read gateway health", "err", err)
+		return ctrl.Result{}, err
 	}
-	gateserver.Status.Conditions = append(gateserver.Status.Conditions, condition)
 	if err := r.Status().Update(ctx, gateserver); err != nil {
 		r.Log.Info("Failed to update status", "err", err)
+		return ctrl.Result{}, err
+	}
+
+	// Pod failures such as crash loops do not change the deployment, poll until ready
+	if gateserver.Status.Phase != phaseReady {
+		return ctrl.Result{RequeueAfter: healthRequeueInterval}, nil
+	}
+
+	// Certificates and keys issued by the operator are renewed by the operator
+	if next := r.nextRenewal(gateserver); next != nil {
+		return ctrl.Result{RequeueAfter: time.Until(*next) + time.Minute}, nil
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func (r *GateServerReconciler) finalizeGateServer(m *kubegatewayv1beta1.GateServer) error {
-	// TODO(user): Add the cleanup steps that the operator
-	// needs to do before the CR can be deleted. Examples
-	// of finalizers include performing backups and deleting
-	// resources that are not owned by this CR, like a PVC.
-	r.Log.Info("Successfully finalized gateserver")
-	return nil
+// nextRenewal returns the next time a certificate or a key issued by the operator
+// needs to be renewed, or a revoked token pruned, or nil if no renewal is scheduled.
+func (r *GateServerReconciler) nextRenewal(s *kubegatewayv1beta1.GateServer) *time.Time {
+	next := nextKeyEvent(s)
+
+	// Keys rotated by an external signer are not observable, poll the signer public keys
+	if s.Spec.ExternalSigner != nil {
+		syncAt := time.Now().Add(externalSignerSyncInterval)
+		if next == nil || syncAt.Before(*next) {
+			next = &syncAt
+		}
+	}
+
+	if r.certProviderName(s) == certProviderSelfSigned && s.Status.ServingCertExpiry != nil {
+		renewAt := certRenewalTime(s.Status.ServingCertExpiry.Add(-selfSignedCertValidity), s.Status.ServingCertExpiry.Time)
+		if next == nil || renewAt.Before(*next) {
+			next = &renewAt
+		}
+	}
+
+	// Expired tokens are pruned from the token revocation list
+	if s.Status.NextRevocationExpiry != nil {
+		pruneAt := s.Status.NextRevocationExpiry.Time
+		if next == nil || pruneAt.Before(*next) {
+			next = &pruneAt
+		}
+	}
+
+	return next
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Changes or deletions of the generated child resources trigger a reconcile
+// of the owning GateServer, so the server self-heals.
+// Exposure and certificate resources are watched only when their API is served by the cluster.
 func (r *GateServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&kubegatewayv1beta1.GateServer{}).
-		Complete(r)
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.gateServersForSecret)).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
+		Watches(&source.Kind{Type: &rbacv1.Role{}}, handler.EnqueueRequestsFromMapFunc(gateServerForLabels)).
+		Watches(&source.Kind{Type: &rbacv1.RoleBinding{}}, handler.EnqueueRequestsFromMapFunc(gateServerForLabels)).
+		Watches(&source.Kind{Type: &rbacv1.ClusterRole{}}, handler.EnqueueRequestsFromMapFunc(r.gateServersForClusterRole)).
+		Watches(&source.Kind{Type: &rbacv1.ClusterRoleBinding{}}, handler.EnqueueRequestsFromMapFunc(gateServerForLabels))
+
+	if r.APIs.Route {
+		b = b.Owns(&routev1.Route{})
+	}
+	if r.APIs.Ingress {
+		b = b.Owns(&networkingv1.Ingress{})
+	}
+	if r.APIs.CertManager {
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(certManagerGroupVersion.WithKind("Certificate"))
+		b = b.Owns(certificate)
+	}
+	if !r.APIs.HTTPRoute.Empty() {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(r.APIs.HTTPRoute.WithKind("HTTPRoute"))
+		b = b.Owns(route)
+	}
+	if !r.APIs.BackendTLSPolicy.Empty() {
+		policy := &unstructured.Unstructured{}
+		policy.SetGroupVersionKind(r.APIs.BackendTLSPolicy.WithKind("BackendTLSPolicy"))
+		b = b.Owns(policy)
+	}
+
+	return b.Complete(r)
+}
+
+// gateServersForClusterRole maps a cluster role to the servers referencing it,
+// so servers waiting for a missing cluster role are reconciled once it is created,
+// and to the server that created it.
+func (r *GateServerReconciler) gateServersForClusterRole(obj client.Object) []reconcile.Request {
+	if requests := gateServerForLabels(obj); requests != nil {
+		return requests
+	}
+
+	gateservers := &kubegatewayv1beta1.GateServerList{}
+	if err := r.List(context.Background(), gateservers); err != nil {
+		r.Log.Info("Failed to list gateservers", "err", err)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, s := range gateservers.Items {
+		if s.Spec.ClusterRole == obj.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: s.Name, Namespace: s.Namespace},
+			})
+		}
+	}
+
+	return requests
+}
+
+// gateServersForSecret maps a user supplied secret to the servers referencing it,
+// e.g. a signing key or k8s API credentials, so changes to the secret are validated
+// and rolled out to the gateway.
+func (r *GateServerReconciler) gateServersForSecret(obj client.Object) []reconcile.Request {
+	gateservers := &kubegatewayv1beta1.GateServerList{}
+	if err := r.List(context.Background(), gateservers, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Info("Failed to list gateservers", "err", err)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, s := range gateservers.Items {
+		if s.Spec.APISecret == obj.GetName() ||
+			(s.Spec.SigningKey != nil && s.Spec.SigningKey.Name == obj.GetName()) ||
+			(s.Spec.ExternalSigner != nil && s.Spec.ExternalSigner.CredentialsSecret == obj.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: s.Name, Namespace: s.Namespace},
+			})
+		}
+	}
+
+	return requests
 }
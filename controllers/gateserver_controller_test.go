@@ -0,0 +1,272 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// createNamespace creates a namespace with a generated name, and returns its name
+func createNamespace() string {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "gateserver-"}}
+	Expect(k8sClient.Create(context.Background(), namespace)).To(Succeed())
+
+	return namespace.Name
+}
+
+// newGateServerReconciler returns a server reconciler of the test environment, the test
+// environment serves no optional APIs.
+func newGateServerReconciler() *GateServerReconciler {
+	return &GateServerReconciler{
+		Client: k8sClient,
+		Scheme: scheme.Scheme,
+		Log:    ctrl.Log.WithName("controllers").WithName("GateServer"),
+	}
+}
+
+// newGateServer returns a server in a new namespace
+func newGateServer() *kubegatewayv1beta1.GateServer {
+	s := &kubegatewayv1beta1.GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: createNamespace()}}
+	s.Spec.Route = "gateway.example.com"
+	s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:latest"
+
+	return s
+}
+
+// reconcileServer reconciles the server, and returns the reconcile error and the stored server
+func reconcileServer(r *GateServerReconciler, s *kubegatewayv1beta1.GateServer) (*kubegatewayv1beta1.GateServer, error) {
+	ctx := context.Background()
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(s)})
+
+	stored := &kubegatewayv1beta1.GateServer{}
+	Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(s), stored)).To(Succeed())
+
+	return stored, err
+}
+
+// getObject reads an object of the server namespace, named after the server unless the object has a name
+func getObject(s *kubegatewayv1beta1.GateServer, obj client.Object) error {
+	name := obj.GetName()
+	if name == "" {
+		name = s.Name
+	}
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = s.Namespace
+	}
+
+	return k8sClient.Get(context.Background(), client.ObjectKey{Name: name, Namespace: namespace}, obj)
+}
+
+var _ = Describe("GateServer cluster role", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		s.Spec.ClusterRole = "gateserver-test-view"
+		s.Spec.TargetNamespaces = []string{createNamespace()}
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+	})
+
+	It("reports a missing cluster role and does not bind it", func() {
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "ClusterRoleFound")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+
+		err = getObject(s, &rbacv1.RoleBinding{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		rolebindings := &rbacv1.RoleBindingList{}
+		Expect(k8sClient.List(context.Background(), rolebindings, gateServerSelector(s))).To(Succeed())
+		Expect(rolebindings.Items).To(BeEmpty())
+	})
+
+	It("binds the cluster role once it is created", func() {
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterrole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: s.Spec.ClusterRole}}
+		Expect(k8sClient.Create(context.Background(), clusterrole)).To(Succeed())
+		defer k8sClient.Delete(context.Background(), clusterrole)
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "ClusterRoleFound")).To(BeTrue())
+
+		rolebinding := &rbacv1.RoleBinding{}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Name).To(Equal(s.Spec.ClusterRole))
+
+		rolebinding = &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: scopedName(s), Namespace: s.Spec.TargetNamespaces[0]}}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Name).To(Equal(s.Spec.ClusterRole))
+	})
+
+	It("switches between the generated role and the cluster role", func() {
+		ctx := context.Background()
+		clusterrole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: s.Spec.ClusterRole}}
+		Expect(k8sClient.Create(ctx, clusterrole)).To(Succeed())
+		defer k8sClient.Delete(ctx, clusterrole)
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(getObject(s, &rbacv1.Role{}))).To(BeTrue())
+
+		// Without a cluster role, the generated role is bound
+		stored.Spec.ClusterRole = ""
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		stored, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(stored.Status.Conditions, "ClusterRoleFound")).To(BeNil())
+
+		Expect(getObject(s, &rbacv1.Role{})).To(Succeed())
+		rolebinding := &rbacv1.RoleBinding{}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Kind).To(Equal("Role"))
+
+		// Setting the cluster role again removes the generated role
+		stored.Spec.ClusterRole = clusterrole.Name
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(errors.IsNotFound(getObject(s, &rbacv1.Role{}))).To(BeTrue())
+		rolebinding = &rbacv1.RoleBinding{}
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Kind).To(Equal("ClusterRole"))
+		Expect(rolebinding.RoleRef.Name).To(Equal(clusterrole.Name))
+	})
+})
+
+var _ = Describe("GateServer token audience", func() {
+	It("reports a gateway image that does not check the token issuer and audience", func() {
+		r := newGateServerReconciler()
+		s := newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "AudienceEnforced")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("GatewayVersionUnsupported"))
+
+		stored.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		Expect(k8sClient.Update(context.Background(), stored)).To(Succeed())
+
+		stored, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "AudienceEnforced")).To(BeTrue())
+
+		deployment := &appsv1.Deployment{}
+		Expect(getObject(s, deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElement("-jwt-audience=gateway.example.com"))
+	})
+})
+
+var _ = Describe("GateServer watches", func() {
+	It("repairs gateway resources changed while the controller is running", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mgr, err := ctrl.NewManager(testEnv.Config, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		r := &GateServerReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			Log:    ctrl.Log.WithName("controllers").WithName("GateServer"),
+		}
+		Expect(r.SetupWithManager(mgr)).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+
+		s := newGateServer()
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+		Eventually(func() error {
+			return getObject(s, &corev1.Service{})
+		}, 30*time.Second).Should(Succeed())
+
+		// A deleted service is re-created
+		service := &corev1.Service{}
+		Expect(getObject(s, service)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, service)).To(Succeed())
+		Eventually(func() bool {
+			restored := &corev1.Service{}
+			return getObject(s, restored) == nil && restored.UID != service.UID
+		}, 30*time.Second).Should(BeTrue())
+
+		// Changed role rules are reverted
+		role := &rbacv1.Role{}
+		Eventually(func() error {
+			return getObject(s, role)
+		}, 30*time.Second).Should(Succeed())
+		rules := role.Rules
+		role.Rules = []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}}
+		Expect(k8sClient.Update(ctx, role)).To(Succeed())
+		Eventually(func() []rbacv1.PolicyRule {
+			restored := &rbacv1.Role{}
+			Expect(getObject(s, restored)).To(Succeed())
+			return restored.Rules
+		}, 30*time.Second).Should(Equal(rules))
+	})
+
+	It("maps labeled resources outside the server namespace to the server", func() {
+		s := newGateServer()
+		binding := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: scopedName(s), Labels: gateServerLabels(s)}}
+
+		Expect(gateServerForLabels(binding)).To(Equal([]reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(s)}}))
+		Expect(gateServerForLabels(&rbacv1.ClusterRoleBinding{})).To(BeEmpty())
+	})
+
+	It("maps a referenced secret to the server", func() {
+		r := newGateServerReconciler()
+		s := newGateServer()
+		s.Spec.APISecret = "remote-cluster"
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "remote-cluster", Namespace: s.Namespace}}
+		Expect(r.gateServersForSecret(secret)).To(Equal([]reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(s)}}))
+
+		other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: s.Namespace}}
+		Expect(r.gateServersForSecret(other)).To(BeEmpty())
+	})
+})
@@ -24,10 +24,12 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/golang-jwt/jwt"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -35,6 +37,9 @@ import (
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
 )
 
+// gatetokenFinalizer revokes the token when it is deleted
+const gatetokenFinalizer = "kubegateway.kubevirt.io/revoke-token"
+
 // GateTokenReconciler reconciles a GateToken object
 type GateTokenReconciler struct {
 	client.Client
@@ -42,9 +47,11 @@ type GateTokenReconciler struct {
 	Scheme *runtime.Scheme
 }
 
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups=security.openshift.io,resources=securitycontextconstraints,resourceNames=privileged,verbs=use
-// +kubebuilder:rbac:groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=kubegateway.kubevirt.io,resources=gateservers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kubegateway.kubevirt.io,resources=gatetokens,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=kubegateway.kubevirt.io,resources=gatetokens/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=kubegateway.kubevirt.io,resources=gatetokens/finalizers,verbs=update
 
@@ -77,12 +84,90 @@ func (r *GateTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
-	// If token was created, exit.
-	if token.Status.Phase != "" {
-		r.Log.Info("Old token", "id", token.Name)
+	// Revoke the token when it is deleted
+	if token.GetDeletionTimestamp() != nil {
+		if controllerutil.ContainsFinalizer(token, gatetokenFinalizer) {
+			// Keep the finalizer so that revocation is retried on the next reconcile
+			if _, err := r.revokeToken(ctx, token); err != nil {
+				r.Log.Info("Can't revoke token", "err", err)
+				return ctrl.Result{}, err
+			}
+
+			controllerutil.RemoveFinalizer(token, gatetokenFinalizer)
+			if err := r.Update(ctx, token); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Revoke the token when requested, a revoked token is never signed again
+	if token.Spec.Revoked {
+		if token.Status.Phase == "Revoked" {
+			return ctrl.Result{}, nil
+		}
+
+		s, err := r.revokeToken(ctx, token)
+		if err != nil {
+			r.Log.Info("Can't revoke token", "err", err)
+
+			setErrorCondition(token, "RevocationError", err)
+			if err := r.Status().Update(ctx, token); err != nil {
+				r.Log.Info("Failed to update status", "err", err)
+			}
+			return ctrl.Result{}, err
+		}
+
+		// A token that is not rejected by the gateway is reported as not revoked, it is never signed
+		// again, and is revoked again when reconciled, e.g. once the gateway image is upgraded
+		switch {
+		case !token.Signed() && len(token.Status.Superseded) == 0:
+			setRevokedCondition(token, "token revoked before it was signed")
+		case s == nil:
+			setRevocationNotEnforcedCondition(token, "no gate server uses the token signing key, the token is valid until it expires")
+		case !extendedGateway(s):
+			setRevocationNotEnforcedCondition(token, fmt.Sprintf("token added to the revocation list of gate server %s, the gateway image does not enforce revocation, the token is valid until it expires", s.Name))
+		default:
+			// The token is rejected by the gateway, it is no longer delivered
+			if err := r.deleteTokenSecret(ctx, token); err != nil {
+				return ctrl.Result{}, err
+			}
+			token.Status.Token = ""
+			token.Status.TokenSecretRef = nil
+			setRevokedCondition(token, fmt.Sprintf("token revoked by gate server %s", s.Name))
+		}
+		if err := r.Status().Update(ctx, token); err != nil {
+			r.Log.Info("Failed to update status", "err", err)
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// Add finalizer for this CR
+	if !controllerutil.ContainsFinalizer(token, gatetokenFinalizer) {
+		controllerutil.AddFinalizer(token, gatetokenFinalizer)
+		if err := r.Update(ctx, token); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// If token was created, exit, unless a new token is requested, or the spec of a token
+	// that failed is changed.
+	if token.Status.Phase != "" && token.Spec.Reissue == token.Status.Reissue && !specChangedSinceError(token) {
+		r.Log.Info("Old token", "id", token.Name)
+		return ctrl.Result{}, r.restoreTokenSecret(ctx, token)
+	}
+
+	// Apply the defaults of tokens created without the defaulting webhook, before the reissue
+	// counter is copied, so a reissued token starts at the time it is signed
+	token.Default()
+
+	// Replace the signed token
+	if token.Signed() {
+		r.Log.Info("Reissue token", "id", token.Name, "reissue", token.Spec.Reissue)
+		supersedeToken(token)
+	}
+	token.Status.Reissue = token.Spec.Reissue
+
 	// Parse and cache user data.
 	if err := cacheData(token); err != nil {
 		r.Log.Info("Can't parse token data", "err", err)
@@ -95,12 +180,12 @@ func (r *GateTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
-	// Get private key secret
-	key, err := getSecret(ctx, r.Client, token.Spec.SecretName, token.Spec.SecretNamespace, token.Spec.SecretFile)
+	// Get the signer of the referenced gate server or secret
+	signer, reason, err := r.tokenSigner(ctx, token)
 	if err != nil {
-		r.Log.Info("Can't read private key secret", "err", err)
+		r.Log.Info("Can't create token signer", "err", err)
 
-		setErrorCondition(token, "PrivateKeyError", err)
+		setErrorCondition(token, reason, err)
 		if err := r.Status().Update(ctx, token); err != nil {
 			r.Log.Info("Failed to update status", "err", err)
 		}
@@ -109,11 +194,26 @@ func (r *GateTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 
 	// Create token
-	err = singToken(token, key)
+	err = singToken(ctx, token, signer)
 	if err != nil {
-		r.Log.Info("Can't read private key secret", "err", err)
+		r.Log.Info("Can't sign token", "err", err)
 
-		setErrorCondition(token, "PrivateKeyError", err)
+		setErrorCondition(token, "SigningError", err)
+		if err := r.Status().Update(ctx, token); err != nil {
+			r.Log.Info("Failed to update status", "err", err)
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	// Deliver token
+	if err := r.deliverToken(ctx, token); err != nil {
+		r.Log.Info("Can't deliver token", "err", err)
+
+		// Do not leak a token delivered using a secret to the status
+		token.Status.Token = ""
+		token.Status.TokenSecretRef = nil
+		setErrorCondition(token, "TokenSecretError", err)
 		if err := r.Status().Update(ctx, token); err != nil {
 			r.Log.Info("Failed to update status", "err", err)
 		}
@@ -133,41 +233,94 @@ func (r *GateTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 func (r *GateTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubegatewayv1beta1.GateToken{}).
+		Owns(&corev1.Secret{}).
 		Complete(r)
 }
 
-// Cache user data
-func cacheData(token *kubegatewayv1beta1.GateToken) error {
-	var notBeforeTime int64
-	var duration time.Duration
-
-	// Default from is "now"
-	if token.Spec.From == "" {
-		notBeforeTime = int64(time.Now().Unix())
-	} else {
-		fromTime, err := time.Parse(time.RFC3339, token.Spec.From)
+// tokenSigner returns the signer of a token, the signer of the referenced gate server, or
+// the signer of the gate server using the referenced secret as signing key.
+// On error, returns the reason of the error condition.
+func (r *GateTokenReconciler) tokenSigner(ctx context.Context, token *kubegatewayv1beta1.GateToken) (Signer, string, error) {
+	if token.Spec.GateServerRef == "" {
+		secret, err := getSecret(ctx, r.Client, token.Spec.SecretName, token.Spec.SecretNamespace)
+		if err != nil {
+			return nil, "PrivateKeyError", err
+		}
+
+		s, err := gateServerForSecret(ctx, r.Client, secret)
 		if err != nil {
-			return err
+			return nil, "PrivateKeyError", err
 		}
-		notBeforeTime = int64(fromTime.Unix())
+		signer, err := signerForSecret(ctx, r.Client, s, secret, token.Spec.SecretFile)
+		if err != nil {
+			return nil, "PrivateKeyError", err
+		}
+		setTokenIssuer(token, s)
+		return signer, "", nil
 	}
 
-	// Default Verbs is ["get"]
-	if token.Spec.Verbs == nil {
-		token.Spec.Verbs = []string{"get"}
+	s := &kubegatewayv1beta1.GateServer{}
+	if err := r.Get(ctx, types.NamespacedName{Name: token.Spec.GateServerRef, Namespace: token.Namespace}, s); err != nil {
+		return nil, "GateServerError", err
 	}
 
-	// Default DurationSec is 3600s (1h)
-	if token.Spec.Duration == "" {
-		token.Spec.Duration = "1h"
+	// The gateway can only access namespaces in the server scope
+	for _, pattern := range token.Spec.URLs {
+		if msg := s.URLScopeError(pattern); msg != "" {
+			return nil, "ScopeError", fmt.Errorf("url %s: %s", pattern, msg)
+		}
 	}
 
-	if token.Spec.SecretNamespace == "" {
-		token.Spec.SecretNamespace = token.Namespace
+	signer, err := signerForGateServer(ctx, r.Client, s)
+	if err != nil {
+		return nil, "PrivateKeyError", err
 	}
+	token.Status.Route = s.Spec.Route
+	setTokenIssuer(token, s)
+
+	return signer, "", nil
+}
+
+// tokenIssuer is the identity of a gate server, set in the "iss" claim of the tokens signed for the server
+func tokenIssuer(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("kube-gateway/%s/%s", s.Namespace, s.Name)
+}
+
+// setTokenIssuer caches the issuer and the audience of a token signed for the gate server, the server
+// identity and route host. Both are empty for a token signed using a secret not used by a gate server.
+func setTokenIssuer(token *kubegatewayv1beta1.GateToken, s *kubegatewayv1beta1.GateServer) {
+	token.Status.Data.Issuer = ""
+	token.Status.Data.Audience = ""
+	if s != nil {
+		token.Status.Data.Issuer = tokenIssuer(s)
+		token.Status.Data.Audience = s.Spec.Route
+	}
+}
+
+// Cache user data, the token defaults are expected to be applied
+func cacheData(token *kubegatewayv1beta1.GateToken) error {
+	fromTime, err := time.Parse(time.RFC3339, token.Spec.From)
+	if err != nil {
+		return err
+	}
+	notBeforeTime := int64(fromTime.Unix())
 
 	// Set gate token cache data
-	duration, _ = time.ParseDuration(token.Spec.Duration)
+	duration, err := time.ParseDuration(token.Spec.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", token.Spec.Duration, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid duration %q: duration must be positive", token.Spec.Duration)
+	}
+	// Each signed token has a unique ID, used to revoke it
+	id, err := newTokenID()
+	if err != nil {
+		return err
+	}
+	token.Status.Data.ID = id
+	token.Status.Data.IAt = time.Now().Unix()
+	token.Status.Data.Subject = token.Annotations[kubegatewayv1beta1.RequesterAnnotation]
 	token.Status.Data.NBf = notBeforeTime
 	token.Status.Data.Exp = notBeforeTime + int64(duration.Seconds())
 	token.Status.Data.From = time.Unix(notBeforeTime, 0).UTC().Format(time.RFC3339)
@@ -179,7 +332,7 @@ func cacheData(token *kubegatewayv1beta1.GateToken) error {
 	return nil
 }
 
-func getSecret(ctx context.Context, client client.Client, name string, namespace string, file string) ([]byte, error) {
+func getSecret(ctx context.Context, client client.Client, name string, namespace string) (*corev1.Secret, error) {
 	// Get private key secret
 	secret := &corev1.Secret{}
 	namespaced := &types.NamespacedName{
@@ -191,8 +344,7 @@ func getSecret(ctx context.Context, client client.Client, name string, namespace
 		return nil, err
 	}
 
-	key := secret.Data[file]
-	return key, nil
+	return secret, nil
 }
 
 func setErrorCondition(token *kubegatewayv1beta1.GateToken, reason string, err error) {
@@ -204,6 +356,42 @@ func setErrorCondition(token *kubegatewayv1beta1.GateToken, reason string, err e
 		Reason:             reason,
 		Message:            fmt.Sprintf("%s", err),
 		LastTransitionTime: t,
+		ObservedGeneration: token.Generation,
+	}
+	token.Status.Conditions = []metav1.Condition{condition}
+}
+
+// specChangedSinceError checks if the spec of a token that failed changed since the error, the
+// token is then signed again using the fixed spec.
+func specChangedSinceError(token *kubegatewayv1beta1.GateToken) bool {
+	condition := meta.FindStatusCondition(token.Status.Conditions, "Error")
+	return token.Status.Phase == "Error" && condition != nil && condition.ObservedGeneration != token.Generation
+}
+
+func setRevokedCondition(token *kubegatewayv1beta1.GateToken, message string) {
+	t := metav1.Time{Time: time.Now()}
+	token.Status.Phase = "Revoked"
+	condition := metav1.Condition{
+		Type:               "Revoked",
+		Status:             "True",
+		Reason:             "TokenRevoked",
+		Message:            message,
+		LastTransitionTime: t,
+	}
+	token.Status.Conditions = []metav1.Condition{condition}
+}
+
+// setRevocationNotEnforcedCondition reports a revoked token that the gateway does not reject,
+// the token is not signed again, but is valid until it expires.
+func setRevocationNotEnforcedCondition(token *kubegatewayv1beta1.GateToken, message string) {
+	t := metav1.Time{Time: time.Now()}
+	token.Status.Phase = "Error"
+	condition := metav1.Condition{
+		Type:               "Revoked",
+		Status:             "False",
+		Reason:             "RevocationNotEnforced",
+		Message:            message,
+		LastTransitionTime: t,
 	}
 	token.Status.Conditions = []metav1.Condition{condition}
 }
@@ -221,24 +409,153 @@ func setReadyCondition(token *kubegatewayv1beta1.GateToken, reason string, messa
 	token.Status.Conditions = []metav1.Condition{condition}
 }
 
-func singToken(token *kubegatewayv1beta1.GateToken, key []byte) error {
+// tokenSecretName is the name of the secret holding a token delivered using a secret
+func tokenSecretName(token *kubegatewayv1beta1.GateToken) string {
+	return fmt.Sprintf("%s-token", token.Name)
+}
+
+// deliverToken writes the signed token to the "token" entry of a secret owned by the token, when the
+// token is delivered using a secret, and removes it from the status. When the token is delivered in
+// the status, the secret of a previous token is removed.
+func (r *GateTokenReconciler) deliverToken(ctx context.Context, token *kubegatewayv1beta1.GateToken) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tokenSecretName(token),
+			Namespace: token.Namespace,
+		},
+	}
+
+	if token.Spec.TokenDelivery != kubegatewayv1beta1.TokenDeliverySecret {
+		return r.deleteTokenSecret(ctx, token)
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		// Do not overwrite a secret created by the user
+		if secret.ResourceVersion != "" && !metav1.IsControlledBy(secret, token) {
+			return fmt.Errorf("secret %s already exists and is not owned by the token", secret.Name)
+		}
+
+		secret.Labels = mergeLabels(secret.Labels, map[string]string{"app": token.Name})
+		secret.Data = map[string][]byte{
+			"token": []byte(token.Status.Token),
+		}
+		return controllerutil.SetControllerReference(token, secret, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	token.Status.TokenSecretRef = &corev1.LocalObjectReference{Name: secret.Name}
+	token.Status.Token = ""
+	return nil
+}
+
+// deleteTokenSecret deletes the secret holding the token, if it is owned by the token
+func (r *GateTokenReconciler) deleteTokenSecret(ctx context.Context, token *kubegatewayv1beta1.GateToken) error {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: tokenSecretName(token), Namespace: token.Namespace}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(secret, token) {
+		return nil
+	}
+
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// restoreTokenSecret signs the cached claims of a token delivered using a secret again, and
+// re-creates the secret when it was deleted.
+func (r *GateTokenReconciler) restoreTokenSecret(ctx context.Context, token *kubegatewayv1beta1.GateToken) error {
+	if token.Status.Phase != "Ready" || token.Status.TokenSecretRef == nil {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: token.Status.TokenSecretRef.Name, Namespace: token.Namespace}, secret)
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	r.Log.Info("Restore token secret", "id", token.Name)
+	signer, _, err := r.tokenSigner(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := singToken(ctx, token, signer); err != nil {
+		return err
+	}
+	if err := r.deliverToken(ctx, token); err != nil {
+		return err
+	}
+
+	return r.Status().Update(ctx, token)
+}
+
+// maxSupersededTokens is the number of superseded tokens listed in the token status
+const maxSupersededTokens = 10
+
+// supersedeToken records the signed token as superseded, and removes it from the status
+func supersedeToken(token *kubegatewayv1beta1.GateToken) {
+	superseded := kubegatewayv1beta1.SupersededToken{
+		Reissue:    token.Status.Reissue,
+		ID:         token.Status.Data.ID,
+		KeyID:      token.Status.Data.KeyID,
+		From:       token.Status.Data.From,
+		Until:      token.Status.Data.Until,
+		Superseded: metav1.Now(),
+	}
+
+	token.Status.Superseded = append([]kubegatewayv1beta1.SupersededToken{superseded}, token.Status.Superseded...)
+	if len(token.Status.Superseded) > maxSupersededTokens {
+		token.Status.Superseded = token.Status.Superseded[:maxSupersededTokens]
+	}
+	token.Status.Token = ""
+	token.Status.TokenSecretRef = nil
+}
+
+// singToken signs the token claims using the signer
+func singToken(ctx context.Context, token *kubegatewayv1beta1.GateToken, signer Signer) error {
 	// Create token
-	claims := &jwt.MapClaims{
+	claims := jwt.MapClaims{
+		"jti":   token.Status.Data.ID,
+		"iat":   token.Status.Data.IAt,
 		"exp":   token.Status.Data.Exp,
 		"nbf":   token.Status.Data.NBf,
 		"URLs":  token.Status.Data.URLs,
 		"verbs": token.Status.Data.Verbs,
 	}
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	jwtKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+
+	// Issuer and audience are unknown without a gate server, and the subject without the requester webhook
+	optional := map[string]string{
+		"iss": token.Status.Data.Issuer,
+		"aud": token.Status.Data.Audience,
+		"sub": token.Status.Data.Subject,
+	}
+	for claim, value := range optional {
+		if value != "" {
+			claims[claim] = value
+		}
+	}
+
+	method, err := jwtSigningMethod(signer.Algorithm())
+	if err != nil {
+		return err
+	}
+	jwtToken := jwt.NewWithClaims(method, claims)
+
+	// Key ID, used by verifiers to pick the public key, and to keep a rotated key while the token is valid
+	jwtToken.Header["kid"] = signer.KeyID()
+	token.Status.Data.KeyID = signer.KeyID()
+
+	signingInput, err := jwtToken.SigningString()
 	if err != nil {
 		return err
 	}
-	out, err := jwtToken.SignedString(jwtKey)
+	signature, err := signer.Sign(ctx, signingInput)
 	if err != nil {
 		return err
 	}
 
-	token.Status.Token = out
+	token.Status.Token = fmt.Sprintf("%s.%s", signingInput, jwt.EncodeSegment(signature))
 	return nil
 }
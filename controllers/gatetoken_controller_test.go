@@ -0,0 +1,282 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// newFakeTokenReconciler returns a token reconciler using a fake client, without admission webhooks,
+// holding a signing key secret named "signing-key" in namespace "ns", and the objects
+func newFakeTokenReconciler(objects ...client.Object) *GateTokenReconciler {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(kubegatewayv1beta1.AddToScheme(scheme)).To(Succeed())
+
+	key, err := generatePrivateKey(2048)
+	Expect(err).NotTo(HaveOccurred())
+	keyPEM, err := encodePrivateKeyToPEM(key)
+	Expect(err).NotTo(HaveOccurred())
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "signing-key", Namespace: "ns"},
+		Data:       map[string][]byte{"tls.key": keyPEM},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objects, secret)...).Build()
+	return &GateTokenReconciler{Client: c, Scheme: scheme, Log: ctrl.Log.WithName("test")}
+}
+
+// newTestToken returns a token signed using the "signing-key" secret
+func newTestToken() *kubegatewayv1beta1.GateToken {
+	return &kubegatewayv1beta1.GateToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "ns"},
+		Spec: kubegatewayv1beta1.GateTokenSpec{
+			URLs:       []string{"/api/v1/namespaces/ns/pods"},
+			SecretName: "signing-key",
+		},
+	}
+}
+
+// newGateTokenReconciler returns a token reconciler of the test environment
+func newGateTokenReconciler() *GateTokenReconciler {
+	return &GateTokenReconciler{
+		Client: k8sClient,
+		Scheme: scheme.Scheme,
+		Log:    ctrl.Log.WithName("controllers").WithName("GateToken"),
+	}
+}
+
+// newGateToken returns a token signed for the server, allowing access to the server namespace pods,
+// with the defaults stored by the defaulting webhook
+func newGateToken(s *kubegatewayv1beta1.GateServer) *kubegatewayv1beta1.GateToken {
+	token := &kubegatewayv1beta1.GateToken{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: s.Namespace}}
+	token.Spec.GateServerRef = s.Name
+	token.Spec.URLs = []string{"/api/v1/namespaces/" + s.Namespace + "/pods"}
+	token.Default()
+
+	return token
+}
+
+// reconcileGateToken reconciles the token, and returns the stored token
+func reconcileGateToken(r *GateTokenReconciler, token *kubegatewayv1beta1.GateToken) *kubegatewayv1beta1.GateToken {
+	ctx := context.Background()
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(token)})
+	Expect(err).NotTo(HaveOccurred())
+
+	stored := &kubegatewayv1beta1.GateToken{}
+	Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(token), stored)).To(Succeed())
+
+	return stored
+}
+
+var _ = Describe("GateToken signing", func() {
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		s = newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+		_, err := reconcileServer(newGateServerReconciler(), s)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("signs a token that failed once its spec is fixed", func() {
+		ctx := context.Background()
+		r := newGateTokenReconciler()
+
+		token := newGateToken(s)
+		token.Spec.GateServerRef = "missing"
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Error"))
+
+		// The failed token is not signed again while its spec is unchanged
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Error"))
+		Expect(token.Signed()).To(BeFalse())
+
+		token.Spec.GateServerRef = s.Name
+		Expect(k8sClient.Update(ctx, token)).To(Succeed())
+
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+		Expect(token.Signed()).To(BeTrue())
+		Expect(token.Status.Route).To(Equal(s.Spec.Route))
+	})
+
+	It("supersedes the signed token when reissued", func() {
+		ctx := context.Background()
+		r := newGateTokenReconciler()
+
+		token := newGateToken(s)
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+		id := token.Status.Data.ID
+
+		token.Spec.Reissue = 1
+		Expect(k8sClient.Update(ctx, token)).To(Succeed())
+
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+		Expect(token.Status.Reissue).To(Equal(1))
+		Expect(token.Status.Data.ID).NotTo(Equal(id))
+		Expect(token.Status.Superseded).To(HaveLen(1))
+		Expect(token.Status.Superseded[0].ID).To(Equal(id))
+	})
+
+	It("sets the registered claims identifying the server, the requester and the token", func() {
+		ctx := context.Background()
+		r := newGateTokenReconciler()
+
+		token := newGateToken(s)
+		token.Annotations = map[string]string{kubegatewayv1beta1.RequesterAnnotation: "developer"}
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+
+		claims := jwt.MapClaims{}
+		_, _, err := new(jwt.Parser).ParseUnverified(token.Status.Token, claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims["iss"]).To(Equal(tokenIssuer(s)))
+		Expect(claims["aud"]).To(Equal(s.Spec.Route))
+		Expect(claims["sub"]).To(Equal("developer"))
+		Expect(claims["jti"]).To(Equal(token.Status.Data.ID))
+		Expect(claims["iat"]).To(BeNumerically("~", time.Now().Unix(), 60))
+
+		// Each token has a unique ID
+		other := newGateToken(s)
+		other.Name = "other"
+		Expect(k8sClient.Create(ctx, other)).To(Succeed())
+		other = reconcileGateToken(r, other)
+		Expect(other.Status.Data.ID).NotTo(BeEmpty())
+		Expect(other.Status.Data.ID).NotTo(Equal(token.Status.Data.ID))
+	})
+
+	// The API server rejects an empty from, tokens stored before the defaults were stored
+	// in the spec are reconciled using a fake client.
+	It("starts a token reissued without the defaulting webhook at the time it is signed", func() {
+		token := newTestToken()
+		token.Spec.Reissue = 1
+		token.Status.Phase = "Ready"
+		token.Status.Token = "signed"
+		token.Status.Data.From = "2021-06-01T10:00:00Z"
+		r := newFakeTokenReconciler(token)
+
+		signedAt := time.Now().Add(-time.Second)
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(token)})
+		Expect(err).NotTo(HaveOccurred())
+
+		stored := &kubegatewayv1beta1.GateToken{}
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(token), stored)).To(Succeed())
+		Expect(stored.Status.Phase).To(Equal("Ready"))
+		Expect(stored.Status.Reissue).To(Equal(1))
+
+		from, err := time.Parse(time.RFC3339, stored.Status.Data.From)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(from).NotTo(BeTemporally("<", signedAt))
+		Expect(stored.Status.Superseded).To(HaveLen(1))
+		Expect(stored.Status.Superseded[0].From).To(Equal("2021-06-01T10:00:00Z"))
+	})
+})
+
+var _ = Describe("GateToken secret delivery", func() {
+	var s *kubegatewayv1beta1.GateServer
+	var r *GateTokenReconciler
+
+	BeforeEach(func() {
+		s = newGateServer()
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+		_, err := reconcileServer(newGateServerReconciler(), s)
+		Expect(err).NotTo(HaveOccurred())
+
+		r = newGateTokenReconciler()
+	})
+
+	// newSecretToken creates a token delivered using a secret, and returns the signed token
+	newSecretToken := func() *kubegatewayv1beta1.GateToken {
+		token := newGateToken(s)
+		token.Spec.TokenDelivery = kubegatewayv1beta1.TokenDeliverySecret
+		Expect(k8sClient.Create(context.Background(), token)).To(Succeed())
+
+		return reconcileGateToken(r, token)
+	}
+
+	It("keeps the token out of the status when the secret can not be written", func() {
+		// A secret created by the user blocks the delivery
+		userSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "example-token", Namespace: s.Namespace}}
+		Expect(k8sClient.Create(context.Background(), userSecret)).To(Succeed())
+
+		token := newSecretToken()
+		Expect(token.Status.Phase).To(Equal("Error"))
+		Expect(token.Status.Token).To(BeEmpty())
+		Expect(token.Status.TokenSecretRef).To(BeNil())
+	})
+
+	It("re-creates a deleted token secret", func() {
+		token := newSecretToken()
+		Expect(token.Status.Phase).To(Equal("Ready"))
+		Expect(token.Status.Token).To(BeEmpty())
+		Expect(token.Status.TokenSecretRef).NotTo(BeNil())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: token.Status.TokenSecretRef.Name}}
+		Expect(getObject(s, secret)).To(Succeed())
+		Expect(secret.Data["token"]).NotTo(BeEmpty())
+		Expect(k8sClient.Delete(context.Background(), secret)).To(Succeed())
+
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+
+		restored := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: token.Status.TokenSecretRef.Name}}
+		Expect(getObject(s, restored)).To(Succeed())
+		Expect(restored.Data["token"]).NotTo(BeEmpty())
+		Expect(metav1.IsControlledBy(restored, token)).To(BeTrue())
+	})
+
+	It("deletes the token secret when the token is revoked", func() {
+		token := newSecretToken()
+		Expect(token.Status.TokenSecretRef).NotTo(BeNil())
+		name := token.Status.TokenSecretRef.Name
+
+		token.Spec.Revoked = true
+		Expect(k8sClient.Update(context.Background(), token)).To(Succeed())
+
+		token = reconcileGateToken(r, token)
+		Expect(token.Status.Phase).To(Equal("Revoked"))
+		Expect(token.Status.TokenSecretRef).To(BeNil())
+
+		err := getObject(s, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// gatewayVersionAnnotation declares the kube-gateway version of a gateway image
+// whose tag is not a version, e.g. "latest" or an image digest.
+const gatewayVersionAnnotation = "kubegateway.kubevirt.io/gateway-version"
+
+// minExtendedGatewayVersion is the first kube-gateway version defining the signing key entry,
+// token revocation, issuer and audience flags. Older versions exit on an undefined flag.
+const minExtendedGatewayVersion = "v0.2.0"
+
+// gatewayVersion returns the kube-gateway version of the server image, declared in the
+// gateway-version annotation or parsed from the image tag, or nil if it is unknown.
+func gatewayVersion(s *kubegatewayv1beta1.GateServer) *version.Version {
+	v := s.Annotations[gatewayVersionAnnotation]
+	if v == "" {
+		v = imageTag(s.Spec.IMG)
+	}
+
+	parsed, err := version.ParseGeneric(v)
+	if err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// imageTag returns the tag of an image reference, or an empty string if the image is referenced by digest
+func imageTag(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// extendedGateway checks if the gateway image defines the extended flags, images of an unknown
+// version are started using the flags defined by all versions.
+func extendedGateway(s *kubegatewayv1beta1.GateServer) bool {
+	v := gatewayVersion(s)
+	return v != nil && v.AtLeast(version.MustParseGeneric(minExtendedGatewayVersion))
+}
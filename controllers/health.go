@@ -0,0 +1,208 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Gateway phases
+const (
+	phaseReady       = "Ready"
+	phaseProgressing = "Progressing"
+	phaseDegraded    = "Degraded"
+	phaseError       = "Error"
+)
+
+// Container waiting reasons that will not resolve without user intervention
+var failedWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// updateHealth sets the gateway phase, replica counts and the Available,
+// Progressing and Degraded conditions from the gateway deployment and pods.
+func (r *GateServerReconciler) updateHealth(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: s.Name, Namespace: s.Namespace}, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			// The deployment was just created and is not cached yet, or was deleted and is re-created,
+			// the deployment watch reconciles the server again once it is observed
+			setDeploymentNotFound(s)
+			return nil
+		}
+		return err
+	}
+
+	s.Status.Replicas = deployment.Status.Replicas
+	s.Status.ReadyReplicas = deployment.Status.ReadyReplicas
+
+	available := deploymentCondition(deployment, appsv1.DeploymentAvailable)
+	progressing := deploymentCondition(deployment, appsv1.DeploymentProgressing)
+	replicaFailure := deploymentCondition(deployment, appsv1.DeploymentReplicaFailure)
+
+	// The deployment controller did not catch up with the last change yet
+	rolledOut := deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == deployment.Status.Replicas
+
+	// Available
+	if available != nil && available.Status == corev1.ConditionTrue && deployment.Status.ReadyReplicas > 0 {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Available",
+			Status:  metav1.ConditionTrue,
+			Reason:  "MinimumReplicasAvailable",
+			Message: fmt.Sprintf("%d/%d gateway pods ready", deployment.Status.ReadyReplicas, deployment.Status.Replicas),
+		})
+	} else {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Available",
+			Status:  metav1.ConditionFalse,
+			Reason:  "MinimumReplicasUnavailable",
+			Message: fmt.Sprintf("%d/%d gateway pods ready", deployment.Status.ReadyReplicas, deployment.Status.Replicas),
+		})
+	}
+
+	// Degraded
+	degradedReason, degradedMessage, err := r.degradedReason(ctx, s, progressing, replicaFailure)
+	if err != nil {
+		return err
+	}
+	if degradedReason != "" {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Degraded",
+			Status:  metav1.ConditionTrue,
+			Reason:  degradedReason,
+			Message: degradedMessage,
+		})
+	} else {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Degraded",
+			Status:  metav1.ConditionFalse,
+			Reason:  "AsExpected",
+			Message: "Gateway pods are running",
+		})
+	}
+
+	// Progressing
+	if !rolledOut || (progressing != nil && progressing.Status == corev1.ConditionTrue && progressing.Reason != "NewReplicaSetAvailable") {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Progressing",
+			Status:  metav1.ConditionTrue,
+			Reason:  "RollingOut",
+			Message: fmt.Sprintf("%d/%d gateway pods updated", deployment.Status.UpdatedReplicas, deployment.Status.Replicas),
+		})
+	} else {
+		setServerCondition(s, metav1.Condition{
+			Type:    "Progressing",
+			Status:  metav1.ConditionFalse,
+			Reason:  "RolledOut",
+			Message: "Gateway deployment is up to date",
+		})
+	}
+
+	// Phase
+	switch {
+	case degradedReason != "":
+		s.Status.Phase = phaseDegraded
+	case available == nil || available.Status != corev1.ConditionTrue || deployment.Status.ReadyReplicas == 0:
+		s.Status.Phase = phaseProgressing
+	case !rolledOut:
+		s.Status.Phase = phaseProgressing
+	default:
+		s.Status.Phase = phaseReady
+	}
+
+	return nil
+}
+
+// setDeploymentNotFound reports a gateway that has no deployment yet as progressing
+func setDeploymentNotFound(s *kubegatewayv1beta1.GateServer) {
+	message := "Waiting for the gateway deployment to be created"
+
+	s.Status.Replicas = 0
+	s.Status.ReadyReplicas = 0
+	setServerCondition(s, metav1.Condition{
+		Type:    "Available",
+		Status:  metav1.ConditionFalse,
+		Reason:  "DeploymentNotFound",
+		Message: message,
+	})
+	setServerCondition(s, metav1.Condition{
+		Type:    "Degraded",
+		Status:  metav1.ConditionFalse,
+		Reason:  "DeploymentNotFound",
+		Message: message,
+	})
+	setServerCondition(s, metav1.Condition{
+		Type:    "Progressing",
+		Status:  metav1.ConditionTrue,
+		Reason:  "DeploymentNotFound",
+		Message: message,
+	})
+	s.Status.Phase = phaseProgressing
+}
+
+// degradedReason looks for failures that will not resolve by waiting,
+// a failed rollout or gateway containers that can not start.
+func (r *GateServerReconciler) degradedReason(ctx context.Context, s *kubegatewayv1beta1.GateServer, progressing *appsv1.DeploymentCondition, replicaFailure *appsv1.DeploymentCondition) (string, string, error) {
+	if replicaFailure != nil && replicaFailure.Status == corev1.ConditionTrue {
+		return "ReplicaFailure", replicaFailure.Message, nil
+	}
+	if progressing != nil && progressing.Status == corev1.ConditionFalse {
+		return progressing.Reason, progressing.Message, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(s.Namespace), client.MatchingLabels{"app": s.Name}); err != nil {
+		return "", "", err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Waiting != nil && failedWaitingReasons[status.State.Waiting.Reason] {
+				message := fmt.Sprintf("pod %s: %s", pod.Name, status.State.Waiting.Message)
+				return status.State.Waiting.Reason, message, nil
+			}
+		}
+	}
+
+	return "", "", nil
+}
+
+// deploymentCondition returns the deployment condition of the given type
+func deploymentCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
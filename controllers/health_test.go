@@ -0,0 +1,55 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GateServer health", func() {
+	It("reports a gateway without a deployment as progressing", func() {
+		r := newGateServerReconciler()
+		s := newGateServer()
+
+		Expect(r.updateHealth(context.Background(), s)).To(Succeed())
+		Expect(s.Status.Phase).To(Equal(phaseProgressing))
+
+		condition := meta.FindStatusCondition(s.Status.Conditions, "Progressing")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("DeploymentNotFound"))
+		Expect(meta.IsStatusConditionFalse(s.Status.Conditions, "Available")).To(BeTrue())
+	})
+
+	It("reports a deployment without ready pods as progressing", func() {
+		r := newGateServerReconciler()
+		s := newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		// The test environment runs no deployment controller, the deployment is never rolled out
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.Phase).To(Equal(phaseProgressing))
+		Expect(meta.IsStatusConditionFalse(stored.Status.Conditions, "Available")).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(stored.Status.Conditions, "Degraded")).To(BeTrue())
+	})
+})
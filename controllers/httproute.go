@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// HTTPRoute creates a Gateway API HTTPRoute resource
+// The Gateway API types are not vendored, the route is built as an unstructured object
+// using the HTTPRoute version served by the cluster.
+func (r *GateServerReconciler) HTTPRoute(s *kubegatewayv1beta1.GateServer) (*unstructured.Unstructured, error) {
+	if s.Spec.GatewayName == "" {
+		return nil, fmt.Errorf("gateway-name is required when exposing the server using an HTTPRoute")
+	}
+	if r.APIs.HTTPRoute.Empty() {
+		return nil, fmt.Errorf("the Gateway API HTTPRoute resource is not served by the cluster")
+	}
+	if r.APIs.BackendTLSPolicy.Empty() {
+		return nil, fmt.Errorf("the Gateway API BackendTLSPolicy resource is not served by the cluster, it is required to connect to the gate proxy server using https")
+	}
+
+	gatewayNamespace := s.Spec.GatewayNamespace
+	if gatewayNamespace == "" {
+		gatewayNamespace = s.Namespace
+	}
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(r.APIs.HTTPRoute.WithKind("HTTPRoute"))
+	route.SetName(s.Name)
+	route.SetNamespace(s.Namespace)
+	route.SetLabels(map[string]string{
+		"app": s.Name,
+	})
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": []interface{}{
+			map[string]interface{}{
+				"name":      s.Spec.GatewayName,
+				"namespace": gatewayNamespace,
+			},
+		},
+		"hostnames": []interface{}{s.Spec.Route},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"name": s.Name,
+						"port": int64(8080),
+					},
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(s, route, r.Scheme)
+
+	return route, nil
+}
+
+// reconcileHTTPRoute makes sure the HTTPRoute exists and matches the desired state
+func (r *GateServerReconciler) reconcileHTTPRoute(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.HTTPRoute(s)
+	if err != nil {
+		return err
+	}
+
+	// The gate proxy server only serves https
+	if err := r.reconcileBackendTLSPolicy(ctx, s); err != nil {
+		return err
+	}
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(desired.GroupVersionKind())
+	route.SetName(desired.GetName())
+	route.SetNamespace(desired.GetNamespace())
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+		route.SetLabels(mergeLabels(route.GetLabels(), desired.GetLabels()))
+		route.Object["spec"] = desired.Object["spec"]
+
+		return controllerutil.SetControllerReference(s, route, r.Scheme)
+	})
+
+	return err
+}
+
+// servingCAConfigMapName is the name of the config map holding the CA bundle of the serving certificate
+func servingCAConfigMapName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("%s-serving-ca", s.Name)
+}
+
+// BackendTLSPolicy creates a Gateway API BackendTLSPolicy resource
+// The Gateway API gateway connects to the gate proxy service using https, and validates the
+// serving certificate using the CA bundle in the "<name>-serving-ca" config map.
+func (r *GateServerReconciler) BackendTLSPolicy(s *kubegatewayv1beta1.GateServer) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{}
+	policy.SetGroupVersionKind(r.APIs.BackendTLSPolicy.WithKind("BackendTLSPolicy"))
+	policy.SetName(s.Name)
+	policy.SetNamespace(s.Namespace)
+	policy.SetLabels(map[string]string{
+		"app": s.Name,
+	})
+	policy.Object["spec"] = map[string]interface{}{
+		"targetRefs": []interface{}{
+			map[string]interface{}{
+				"group": "",
+				"kind":  "Service",
+				"name":  s.Name,
+			},
+		},
+		"validation": map[string]interface{}{
+			"caCertificateRefs": []interface{}{
+				map[string]interface{}{
+					"group": "",
+					"kind":  "ConfigMap",
+					"name":  servingCAConfigMapName(s),
+				},
+			},
+			"hostname": fmt.Sprintf("%s.%s.svc", s.Name, s.Namespace),
+		},
+	}
+
+	return policy
+}
+
+// reconcileBackendTLSPolicy makes sure the serving certificate CA bundle is published, and the
+// BackendTLSPolicy exists and matches the desired state
+func (r *GateServerReconciler) reconcileBackendTLSPolicy(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	ca, err := r.servingCA(ctx, s)
+	if err != nil {
+		return err
+	}
+	if ca == "" {
+		return fmt.Errorf("the CA bundle of the serving certificate is not available in secret %s, it is required to validate the gate proxy server", servingCertSecretName(s))
+	}
+
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: servingCAConfigMapName(s), Namespace: s.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, configmap, func() error {
+		configmap.Labels = mergeLabels(configmap.Labels, map[string]string{"app": s.Name})
+		configmap.Data = map[string]string{
+			"ca.crt": ca,
+		}
+
+		return controllerutil.SetControllerReference(s, configmap, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	desired := r.BackendTLSPolicy(s)
+	policy := &unstructured.Unstructured{}
+	policy.SetGroupVersionKind(desired.GroupVersionKind())
+	policy.SetName(desired.GetName())
+	policy.SetNamespace(desired.GetNamespace())
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, policy, func() error {
+		policy.SetLabels(mergeLabels(policy.GetLabels(), desired.GetLabels()))
+		policy.Object["spec"] = desired.Object["spec"]
+
+		return controllerutil.SetControllerReference(s, policy, r.Scheme)
+	})
+
+	return err
+}
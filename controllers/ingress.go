@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Ingress creates an ingress resource
+// The gate proxy server serves https, the ingress controller is asked to re-encrypt
+// the traffic to the service using the ingress-nginx backend protocol annotation, other
+// ingress controllers are not supported. The ingress terminates TLS using the serving
+// certificate, issued for the route host.
+func (r *GateServerReconciler) Ingress(s *kubegatewayv1beta1.GateServer) (*networkingv1.Ingress, error) {
+	labels := map[string]string{
+		"app": s.Name,
+	}
+	annotations := map[string]string{
+		"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+	}
+	pathType := networkingv1.PathTypePrefix
+
+	var ingressClassName *string
+	if s.Spec.IngressClassName != "" {
+		ingressClassName = &s.Spec.IngressClassName
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.Name,
+			Namespace:   s.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: ingressClassName,
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts:      []string{s.Spec.Route},
+					SecretName: servingCertSecretName(s),
+				},
+			},
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: s.Spec.Route,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: s.Name,
+											Port: networkingv1.ServiceBackendPort{
+												Number: 8080,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(s, ingress, r.Scheme)
+
+	return ingress, nil
+}
+
+// reconcileIngress makes sure the ingress exists and matches the desired state
+func (r *GateServerReconciler) reconcileIngress(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.Ingress(s)
+	if err != nil {
+		return err
+	}
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, ingress, func() error {
+		ingress.Labels = mergeLabels(ingress.Labels, desired.Labels)
+		ingress.Annotations = mergeLabels(ingress.Annotations, desired.Annotations)
+		// Keep the default ingress class set by the cluster on creation
+		ingressClassName := ingress.Spec.IngressClassName
+		ingress.Spec = desired.Spec
+		if ingress.Spec.IngressClassName == nil {
+			ingress.Spec.IngressClassName = ingressClassName
+		}
+
+		return controllerutil.SetControllerReference(s, ingress, r.Scheme)
+	})
+
+	return err
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// jwksFile is the entry in the JWKS config map holding the JWKS document
+const jwksFile = "jwks.json"
+
+// jsonWebKey is a public JSON Web Key (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jsonWebKeySet is a JSON Web Key Set document (RFC 7517)
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwksConfigMapName is the name of the config map publishing the JWKS document
+func jwksConfigMapName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("%s-jwks", s.Name)
+}
+
+// publicJWK converts a public key to a JSON Web Key, the key ID is the key thumbprint
+func publicJWK(pub crypto.PublicKey, algorithm string) (jsonWebKey, error) {
+	jwk := jsonWebKey{Use: "sig", Alg: algorithm}
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		jwk.Kid = thumbprint(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(key.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(key.Y.Bytes(), size))
+		jwk.Kid = thumbprint(fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		jwk.Kid = thumbprint(fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, jwk.X))
+	default:
+		return jwk, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return jwk, nil
+}
+
+// padBytes left pads a big endian integer to a fixed size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// blockJWK converts a public key PEM block to a JSON Web Key
+func blockJWK(block *pem.Block) (jsonWebKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return jsonWebKey{}, err
+	}
+
+	algorithm := block.Headers[keyAlgorithmHeader]
+	if algorithm == "" {
+		algorithm = defaultAlgorithm(pub)
+	}
+
+	return publicJWK(pub, algorithm)
+}
+
+// thumbprint hashes the required members of a JSON Web Key (RFC 7638)
+func thumbprint(members string) string {
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// keyID returns the key ID of a public key, set in the "kid" header of tokens signed by the matching private key
+func keyID(pub crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(pub, "")
+	if err != nil {
+		return "", err
+	}
+
+	return jwk.Kid, nil
+}
+
+// jwks converts the public keys in the signing key secret to a JSON Web Key Set, the active key first
+func jwks(secret *corev1.Secret, ref signingSecret) (*jsonWebKeySet, error) {
+	set := &jsonWebKeySet{Keys: []jsonWebKey{}}
+
+	for _, block := range ref.publicKeys(secret) {
+		jwk, err := blockJWK(block)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// reconcileJWKS publishes the public keys valid for verification as a JWKS document,
+// in the "jwks.json" entry of the "<name>-jwks" config map.
+func (r *GateServerReconciler) reconcileJWKS(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	secret, ref, err := r.getSigningSecret(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	set, err := jwks(secret, ref)
+	if err != nil {
+		return err
+	}
+	document, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: jwksConfigMapName(s), Namespace: s.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, configmap, func() error {
+		configmap.Labels = mergeLabels(configmap.Labels, map[string]string{"app": s.Name})
+		configmap.Data = map[string]string{
+			jwksFile: string(document),
+		}
+
+		return controllerutil.SetControllerReference(s, configmap, r.Scheme)
+	})
+
+	return err
+}
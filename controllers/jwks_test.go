@@ -0,0 +1,107 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// rsaJWKPublicKey converts an RSA JSON Web Key to a public key
+func rsaJWKPublicKey(jwk jsonWebKey) *rsa.PublicKey {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	Expect(err).NotTo(HaveOccurred())
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	Expect(err).NotTo(HaveOccurred())
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+}
+
+var _ = Describe("JWKS publication", func() {
+	It("uses the RFC 7638 thumbprint as the key ID", func() {
+		// The example key of RFC 7638 section 3.1
+		jwk := jsonWebKey{
+			N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+			E: "AQAB",
+		}
+
+		kid, err := keyID(rsaJWKPublicKey(jwk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kid).To(Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"))
+	})
+
+	It("publishes the key verifying the tokens signed for the server", func() {
+		ctx := context.Background()
+		r := newGateServerReconciler()
+		s := newGateServer()
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: jwksConfigMapName(s)}}
+		Expect(getObject(s, configmap)).To(Succeed())
+		Expect(metav1.IsControlledBy(configmap, stored)).To(BeTrue())
+
+		set := &jsonWebKeySet{}
+		Expect(json.Unmarshal([]byte(configmap.Data[jwksFile]), set)).To(Succeed())
+		Expect(set.Keys).To(HaveLen(1))
+		Expect(set.Keys[0].Kty).To(Equal("RSA"))
+		Expect(set.Keys[0].Alg).To(Equal(algRS256))
+		Expect(set.Keys[0].Kid).To(Equal(stored.Status.SigningKeys[0].ID))
+
+		token := newGateToken(s)
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+		token = reconcileGateToken(newGateTokenReconciler(), token)
+
+		parsed, err := jwt.Parse(token.Status.Token, func(*jwt.Token) (interface{}, error) {
+			return rsaJWKPublicKey(set.Keys[0]), nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Header["kid"]).To(Equal(set.Keys[0].Kid))
+	})
+
+	It("publishes the retired keys after a rotation, the active key first", func() {
+		r := newGateServerReconciler()
+		s := newGateServer()
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		s.Spec.KeyRotation = &kubegatewayv1beta1.KeyRotation{Interval: "720h", GracePeriod: "24h"}
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		keys := rotateAt(r, s, secret, tokenExpiry{}, time.Now().Add(721*time.Hour))
+		Expect(keys).To(HaveLen(2))
+
+		set, err := jwks(secret, signingSecretOf(s))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(set.Keys).To(HaveLen(2))
+		Expect(set.Keys[0].Kid).To(Equal(keys[0]))
+		Expect(set.Keys[1].Kid).To(Equal(keys[1]))
+	})
+})
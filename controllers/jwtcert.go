@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// jwtCertValidity is the validity of the JWT signing key certificate when the key is not rotated
+const jwtCertValidity = 10 * 365 * 24 * time.Hour
+
+// jwtCertSubject is the subject of the JWT signing key certificate
+func jwtCertSubject(s *kubegatewayv1beta1.GateServer) pkix.Name {
+	return pkix.Name{
+		CommonName:   fmt.Sprintf("%s.%s-jwt", s.Name, s.Namespace),
+		Organization: []string{"kube-gateway"},
+	}
+}
+
+// jwtCertNotAfter is the expiry time of a signing key certificate, a retired key is kept for
+// the rotation grace period, and while the tokens signed before it was retired are valid.
+func jwtCertNotAfter(created time.Time, policy keyRotationPolicy) time.Time {
+	if policy.interval == 0 {
+		return created.Add(jwtCertValidity)
+	}
+
+	retention := policy.gracePeriod
+	if retention < kubegatewayv1beta1.MaxTokenDuration {
+		retention = kubegatewayv1beta1.MaxTokenDuration
+	}
+
+	return created.Add(policy.interval + retention)
+}
+
+// issueJWTCertificates writes a self signed X.509 certificate for each public key valid for
+// verification to the certificate entry, the active key first. A certificate is issued for
+// the active key when it is missing or its validity changed, certificates of retired keys
+// are kept until the key is removed. The "public.pem" entry lists all the public keys.
+func issueJWTCertificates(s *kubegatewayv1beta1.GateServer, secret *corev1.Secret, ref signingSecret, policy keyRotationPolicy) error {
+	privateKey, err := parsePrivateKeyPEM(secret.Data[ref.keyFile])
+	if err != nil {
+		return err
+	}
+
+	// Existing certificates, by public key
+	existing := map[string]*x509.Certificate{}
+	rest := secret.Data[ref.certFile]
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			existing[string(cert.RawSubjectPublicKeyInfo)] = cert
+		}
+	}
+
+	bundle := []byte{}
+	for i, key := range ref.publicKeys(secret) {
+		cert := existing[string(key.Bytes)]
+
+		if i == 0 {
+			created := keyTime(key, keyCreatedHeader)
+			notAfter := jwtCertNotAfter(created, policy)
+
+			if cert == nil || !cert.NotAfter.Equal(notAfter.Truncate(time.Second)) {
+				der, err := createJWTCertificate(s, privateKey, created, notAfter)
+				if err != nil {
+					return err
+				}
+				cert = &x509.Certificate{Raw: der}
+			}
+		}
+
+		if cert != nil {
+			bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	secret.Data[ref.certFile] = bundle
+
+	return nil
+}
+
+// createJWTCertificate creates a self signed certificate for a signing key
+func createJWTCertificate(s *kubegatewayv1beta1.GateServer, key crypto.Signer, created time.Time, notAfter time.Time) ([]byte, error) {
+	template := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               jwtCertSubject(s),
+		NotBefore:             created.Add(-5 * time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+
+	return x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// jwtCertificates parses the certificates in the certificate entry of the signing key secret
+func jwtCertificates(secret *corev1.Secret) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	rest := secret.Data[defaultSigningCertFile]
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		certs = append(certs, cert)
+	}
+}
+
+var _ = Describe("Signing key certificates", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = &kubegatewayv1beta1.GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: "ns"}}
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		s.Spec.RSAKeySize = 2048
+	})
+
+	table.DescribeTable("publishes a self signed certificate of the signing key",
+		func(algorithm string) {
+			s.Spec.SigningAlgorithm = algorithm
+			secret, err := r.Secret(s)
+			Expect(err).NotTo(HaveOccurred())
+
+			certs := jwtCertificates(secret)
+			Expect(certs).To(HaveLen(1))
+			Expect(certs[0].CheckSignature(certs[0].SignatureAlgorithm, certs[0].RawTBSCertificate, certs[0].Signature)).To(Succeed())
+			Expect(certs[0].Subject.CommonName).To(Equal("gateserver-sample.ns-jwt"))
+
+			signer, err := newSecretSigner(secret, defaultSigningKeyFile, "")
+			Expect(err).NotTo(HaveOccurred())
+			kid, err := keyID(certs[0].PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kid).To(Equal(signer.KeyID()))
+		},
+		table.Entry("RS256", algRS256),
+		table.Entry("ES256", algES256),
+		table.Entry("EdDSA", algEdDSA),
+	)
+
+	It("expires the certificate of a rotated key once the tokens it may have signed expire", func() {
+		s.Spec.KeyRotation = &kubegatewayv1beta1.KeyRotation{Interval: "720h", GracePeriod: "24h"}
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		blocks := signingSecretOf(s).publicKeys(secret)
+		created := keyTime(blocks[0], keyCreatedHeader)
+
+		certs := jwtCertificates(secret)
+		Expect(certs).To(HaveLen(1))
+		Expect(certs[0].NotAfter).To(Equal(created.Add(720*time.Hour + kubegatewayv1beta1.MaxTokenDuration).Truncate(time.Second).UTC()))
+	})
+
+	It("keeps the certificates of the retired keys, the active key first", func() {
+		s.Spec.KeyRotation = &kubegatewayv1beta1.KeyRotation{Interval: "720h", GracePeriod: "24h"}
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+		policy, err := keyRotationPolicyOf(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		now := time.Now()
+		keys := rotateAt(r, s, secret, tokenExpiry{}, now.Add(721*time.Hour))
+		Expect(issueJWTCertificates(s, secret, signingSecretOf(s), policy)).To(Succeed())
+
+		certs := jwtCertificates(secret)
+		Expect(certs).To(HaveLen(2))
+		for i, cert := range certs {
+			kid, err := keyID(cert.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kid).To(Equal(keys[i]))
+		}
+
+		// The certificate of a removed key is removed
+		Expect(rotateAt(r, s, secret, tokenExpiry{}, now.Add(746*time.Hour))).To(HaveLen(1))
+		Expect(issueJWTCertificates(s, secret, signingSecretOf(s), policy)).To(Succeed())
+		Expect(jwtCertificates(secret)).To(HaveLen(1))
+	})
+})
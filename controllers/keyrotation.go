@@ -0,0 +1,327 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// PEM headers recording the life cycle of a public key in the JWT secret
+const (
+	keyCreatedHeader = "Created"
+	keyRetiredHeader = "Retired"
+)
+
+// Default key rotation policy
+const (
+	defaultKeyRotationInterval = "720h"
+	defaultKeyGracePeriod      = "24h"
+)
+
+// keyRotationPolicy is the parsed key rotation policy of a server,
+// a zero interval means the signing key is not rotated.
+type keyRotationPolicy struct {
+	interval    time.Duration
+	gracePeriod time.Duration
+}
+
+// keyRotationPolicyOf parses the key rotation policy set in the spec, the signing key is not
+// rotated when the gateway image reads only the first public key.
+func keyRotationPolicyOf(s *kubegatewayv1beta1.GateServer) (keyRotationPolicy, error) {
+	policy := keyRotationPolicy{}
+	if s.Spec.KeyRotation == nil || !extendedGateway(s) {
+		return policy, nil
+	}
+
+	interval := s.Spec.KeyRotation.Interval
+	if interval == "" {
+		interval = defaultKeyRotationInterval
+	}
+	gracePeriod := s.Spec.KeyRotation.GracePeriod
+	if gracePeriod == "" {
+		gracePeriod = defaultKeyGracePeriod
+	}
+
+	var err error
+	if policy.interval, err = time.ParseDuration(interval); err != nil {
+		return policy, fmt.Errorf("invalid key rotation interval: %w", err)
+	}
+	if policy.gracePeriod, err = time.ParseDuration(gracePeriod); err != nil {
+		return policy, fmt.Errorf("invalid key rotation grace period: %w", err)
+	}
+	if policy.interval <= 0 {
+		return policy, fmt.Errorf("key rotation interval must be positive")
+	}
+
+	return policy, nil
+}
+
+// rotateSigningKey replaces the active signing key when it is older than the rotation interval,
+// or when it can not be used by the signing algorithm set in the spec.
+// The public keys are kept in the "public.pem" entry, the active key first, followed by the
+// retired keys that are still valid for verification; retired keys are removed once
+// their grace period is over and the tokens signed by the key expired.
+func (r *GateServerReconciler) rotateSigningKey(secret *corev1.Secret, ref signingSecret, params signingKeyParams, policy keyRotationPolicy, tokens tokenExpiry, now time.Time) error {
+	keys := ref.publicKeys(secret)
+
+	active, err := x509.ParsePKIXPublicKey(keys[0].Bytes)
+	if err != nil {
+		return err
+	}
+
+	expired := policy.interval > 0 && !keyTime(keys[0], keyCreatedHeader).Add(policy.interval).After(now)
+	if expired || !keyMatchesAlgorithm(active, params.algorithm) {
+		r.Log.Info("Rotate JWT signing key.", "secret", secret.Name, "algorithm", params.algorithm)
+
+		privateKey, err := generateSigningKey(params)
+		if err != nil {
+			return err
+		}
+		block, err := publicKeyToPEMBlock(privateKey.Public(), params.algorithm, now)
+		if err != nil {
+			return err
+		}
+		privateKeyBytes, err := encodePrivateKeyToPEM(privateKey)
+		if err != nil {
+			return err
+		}
+
+		keys = append([]*pem.Block{block}, keys...)
+		secret.Data[defaultSigningKeyFile] = privateKeyBytes
+	}
+
+	// The algorithm may change without a new key, e.g. from RS256 to PS256
+	keys[0].Headers[keyAlgorithmHeader] = params.algorithm
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[signingAlgorithmAnnotation] = params.algorithm
+
+	// Retire previous keys, and remove keys after the grace period once the tokens they signed expired
+	bundle := pem.EncodeToMemory(keys[0])
+	for _, key := range keys[1:] {
+		if _, ok := key.Headers[keyRetiredHeader]; !ok {
+			key.Headers[keyRetiredHeader] = now.UTC().Format(time.RFC3339)
+		}
+		if retiredKeyExpiry(key, policy, tokens).After(now) {
+			bundle = append(bundle, pem.EncodeToMemory(key)...)
+		}
+	}
+	secret.Data[ref.publicKeysFile] = bundle
+
+	return nil
+}
+
+// publicKeyBlocks returns the public keys in a secret entry, the active key first.
+// Certificates are converted to their public key, and keys missing a creation time
+// are assumed to be created with the secret.
+func publicKeyBlocks(secret *corev1.Secret, certFile string) []*pem.Block {
+	keys := []*pem.Block{}
+
+	rest := secret.Data[certFile]
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type == "CERTIFICATE" {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				block = &pem.Block{Type: "PUBLIC KEY", Bytes: cert.RawSubjectPublicKeyInfo}
+			} else {
+				// Public keys were labeled as certificates in older secrets
+				block.Type = "PUBLIC KEY"
+			}
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		if block.Headers == nil {
+			block.Headers = map[string]string{}
+		}
+		if _, ok := block.Headers[keyAlgorithmHeader]; !ok {
+			if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+				block.Headers[keyAlgorithmHeader] = defaultAlgorithm(pub)
+			}
+		}
+		if _, ok := block.Headers[keyCreatedHeader]; !ok {
+			created := secret.CreationTimestamp.Time
+			if created.IsZero() {
+				created = time.Now()
+			}
+			block.Headers[keyCreatedHeader] = created.UTC().Format(time.RFC3339)
+		}
+
+		keys = append(keys, block)
+	}
+
+	return keys
+}
+
+// tokenExpiry is the latest expiry time of the tokens signed by each key, by key ID,
+// tokens signed before the key ID was recorded are listed under an empty key ID.
+type tokenExpiry map[string]time.Time
+
+// of returns the latest expiry time of the tokens that may be signed by a key
+func (e tokenExpiry) of(kid string) time.Time {
+	t := e[""]
+	if e[kid].After(t) {
+		t = e[kid]
+	}
+
+	return t
+}
+
+// add records a token signed by a key
+func (e tokenExpiry) add(kid string, exp time.Time) {
+	if exp.After(e[kid]) {
+		e[kid] = exp
+	}
+}
+
+// signedTokenExpiry returns the latest expiry time of the tokens signed by each key, tokens
+// that are revoked or expired are ignored.
+func (r *GateServerReconciler) signedTokenExpiry(ctx context.Context, now time.Time) (tokenExpiry, error) {
+	tokens := &kubegatewayv1beta1.GateTokenList{}
+	if err := r.List(ctx, tokens); err != nil {
+		return nil, err
+	}
+
+	expiry := tokenExpiry{}
+	for _, token := range tokens.Items {
+		if token.Spec.Revoked {
+			continue
+		}
+
+		if token.Signed() {
+			if exp := time.Unix(token.Status.Data.Exp, 0); exp.After(now) {
+				expiry.add(token.Status.Data.KeyID, exp)
+			}
+		}
+		for _, superseded := range token.Status.Superseded {
+			if exp, err := time.Parse(time.RFC3339, superseded.Until); err == nil && exp.After(now) {
+				expiry.add(superseded.KeyID, exp)
+			}
+		}
+	}
+
+	return expiry, nil
+}
+
+// retiredKeyExpiry returns the time a retired key is removed, after the grace period, or
+// when the last token the key may have signed expires.
+func retiredKeyExpiry(block *pem.Block, policy keyRotationPolicy, tokens tokenExpiry) time.Time {
+	expires := keyTime(block, keyRetiredHeader).Add(policy.gracePeriod)
+	if t := tokens.of(blockKeyID(block)); t.After(expires) {
+		expires = t
+	}
+
+	return expires
+}
+
+// keyTime parses a time recorded in a public key header
+func keyTime(block *pem.Block, header string) time.Time {
+	t, err := time.Parse(time.RFC3339, block.Headers[header])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// blockKeyID returns the key ID of a public key PEM block
+func blockKeyID(block *pem.Block) string {
+	jwk, err := blockJWK(block)
+	if err != nil {
+		return ""
+	}
+
+	return jwk.Kid
+}
+
+// signingKeysStatus describes the signing keys in the signing key secret, and the time of the next rotation
+func signingKeysStatus(secret *corev1.Secret, ref signingSecret, policy keyRotationPolicy, tokens tokenExpiry) ([]kubegatewayv1beta1.SigningKeyStatus, *metav1.Time) {
+	keys := []kubegatewayv1beta1.SigningKeyStatus{}
+	var nextRotation *metav1.Time
+
+	for i, block := range ref.publicKeys(secret) {
+		key := kubegatewayv1beta1.SigningKeyStatus{
+			ID:        blockKeyID(block),
+			Algorithm: block.Headers[keyAlgorithmHeader],
+			Created:   metav1.NewTime(keyTime(block, keyCreatedHeader)),
+		}
+
+		if i == 0 {
+			if policy.interval > 0 {
+				t := metav1.NewTime(key.Created.Add(policy.interval))
+				nextRotation = &t
+			}
+		} else {
+			retired := metav1.NewTime(keyTime(block, keyRetiredHeader))
+			expires := metav1.NewTime(retiredKeyExpiry(block, policy, tokens))
+			key.Retired = &retired
+			key.Expires = &expires
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nextRotation
+}
+
+// signingKeysHash returns a hash of the public keys in the signing key secret, used to restart
+// the gateway pods when the signing key is rotated or replaced.
+func (r *GateServerReconciler) signingKeysHash(ctx context.Context, s *kubegatewayv1beta1.GateServer) (string, error) {
+	secret, ref, err := r.getSigningSecret(ctx, s)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(secret.Data[ref.publicKeysFile])
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// nextKeyEvent returns the next time the signing keys change, either the active key is
+// rotated or a retired key expires.
+func nextKeyEvent(s *kubegatewayv1beta1.GateServer) *time.Time {
+	var next *time.Time
+
+	times := []*metav1.Time{s.Status.NextKeyRotation}
+	for _, key := range s.Status.SigningKeys {
+		times = append(times, key.Expires)
+	}
+	for _, t := range times {
+		if t != nil && (next == nil || t.Time.Before(*next)) {
+			next = &t.Time
+		}
+	}
+
+	return next
+}
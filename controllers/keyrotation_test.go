@@ -0,0 +1,143 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// rotateAt rotates the signing key of the server secret as if reconciled at a time,
+// and returns the IDs of the public keys kept for verification.
+func rotateAt(r *GateServerReconciler, s *kubegatewayv1beta1.GateServer, secret *corev1.Secret, tokens tokenExpiry, now time.Time) []string {
+	policy, err := keyRotationPolicyOf(s)
+	Expect(err).NotTo(HaveOccurred())
+
+	ref := signingSecretOf(s)
+	Expect(r.rotateSigningKey(secret, ref, signingKeyParamsOf(s), policy, tokens, now)).To(Succeed())
+
+	ids := []string{}
+	for _, block := range ref.publicKeys(secret) {
+		ids = append(ids, blockKeyID(block))
+	}
+
+	return ids
+}
+
+var _ = Describe("Signing key rotation", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		s.Spec.KeyRotation = &kubegatewayv1beta1.KeyRotation{Interval: "720h", GracePeriod: "24h"}
+	})
+
+	It("keeps a retired key until the tokens it signed expire", func() {
+		ctx := context.Background()
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "KeyRotationEnabled")).To(BeTrue())
+		Expect(stored.Status.SigningKeys).To(HaveLen(1))
+		kid := stored.Status.SigningKeys[0].ID
+
+		// A token valid from a later time outlives the grace period of the key
+		now := time.Now()
+		token := newGateToken(s)
+		token.Spec.From = now.Add(100 * time.Hour).UTC().Format(time.RFC3339)
+		token.Spec.Duration = "720h"
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+
+		token = reconcileGateToken(newGateTokenReconciler(), token)
+		Expect(token.Status.Data.KeyID).To(Equal(kid))
+
+		tokens, err := r.signedTokenExpiry(ctx, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokens[kid]).To(Equal(time.Unix(token.Status.Data.Exp, 0)))
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: jwtSecretName(s)}}
+		Expect(getObject(s, secret)).To(Succeed())
+
+		keys := rotateAt(r, s, secret, tokens, now.Add(721*time.Hour))
+		Expect(keys).To(HaveLen(2))
+		Expect(keys[1]).To(Equal(kid))
+
+		keys = rotateAt(r, s, secret, tokens, now.Add(800*time.Hour))
+		Expect(keys).To(HaveLen(2))
+
+		keys = rotateAt(r, s, secret, tokens, now.Add(821*time.Hour))
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0]).NotTo(Equal(kid))
+	})
+
+	It("rotates the key once the interval has passed", func() {
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		now := time.Now()
+		keys := rotateAt(r, s, secret, tokenExpiry{}, now.Add(719*time.Hour))
+		Expect(keys).To(HaveLen(1))
+
+		// The new key is listed first, the retired key is kept to verify the tokens it signed
+		rotated := rotateAt(r, s, secret, tokenExpiry{}, now.Add(721*time.Hour))
+		Expect(rotated).To(HaveLen(2))
+		Expect(rotated[0]).NotTo(Equal(keys[0]))
+		Expect(rotated[1]).To(Equal(keys[0]))
+	})
+
+	It("removes a retired key after the grace period when no token uses it", func() {
+		s.Spec.IMG = "quay.io/kubevirt-ui/kube-gateway:v0.2.0"
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		now := time.Now()
+		Expect(rotateAt(r, s, secret, tokenExpiry{}, now.Add(721*time.Hour))).To(HaveLen(2))
+		Expect(rotateAt(r, s, secret, tokenExpiry{}, now.Add(746*time.Hour))).To(HaveLen(1))
+	})
+
+	It("does not rotate the key of a gateway image reading only the first key", func() {
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "KeyRotationEnabled")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("GatewayVersionUnsupported"))
+		Expect(stored.Status.NextKeyRotation).To(BeNil())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: jwtSecretName(s)}}
+		Expect(getObject(s, secret)).To(Succeed())
+
+		keys := rotateAt(r, s, secret, tokenExpiry{}, time.Now().Add(10000*time.Hour))
+		Expect(keys).To(Equal([]string{stored.Status.SigningKeys[0].ID}))
+	})
+})
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Token revocation list, the gateway rejects tokens listed in the revocation config map
+const (
+	revokedTokensFile      = "revoked.json"
+	revokedTokensMountPath = "/var/run/kube-gateway/revoked-tokens"
+)
+
+// revokedTokensConfigMapName is the name of the config map holding the token revocation list
+func revokedTokensConfigMapName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("%s-revoked-tokens", s.Name)
+}
+
+// newTokenID returns a random token ID, set in the "jti" claim
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// updateRevokedTokens adds tokens to the revocation list of a gate server, and prunes the expired tokens.
+// The list is a JSON object mapping the ID of each revoked token to its expiry time in unix seconds,
+// in the "revoked.json" entry of the "<name>-revoked-tokens" config map. Returns the updated list.
+func updateRevokedTokens(ctx context.Context, c client.Client, scheme *runtime.Scheme, s *kubegatewayv1beta1.GateServer, revoked map[string]int64) (map[string]int64, error) {
+	tokens := map[string]int64{}
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: revokedTokensConfigMapName(s), Namespace: s.Namespace}}
+
+	// Both the token and the server controllers update the list
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := controllerutil.CreateOrUpdate(ctx, c, configmap, func() error {
+			tokens = map[string]int64{}
+			if document := configmap.Data[revokedTokensFile]; document != "" {
+				if err := json.Unmarshal([]byte(document), &tokens); err != nil {
+					return fmt.Errorf("invalid token revocation list %s: %w", configmap.Name, err)
+				}
+			}
+
+			now := time.Now().Unix()
+			for id, exp := range revoked {
+				tokens[id] = exp
+			}
+			for id, exp := range tokens {
+				if exp <= now {
+					delete(tokens, id)
+				}
+			}
+
+			document, err := json.MarshalIndent(tokens, "", "  ")
+			if err != nil {
+				return err
+			}
+			configmap.Labels = mergeLabels(configmap.Labels, map[string]string{"app": s.Name})
+			configmap.Data = map[string]string{
+				revokedTokensFile: string(document),
+			}
+
+			return controllerutil.SetControllerReference(s, configmap, scheme)
+		})
+		return err
+	})
+
+	return tokens, err
+}
+
+// reconcileRevokedTokens makes sure the token revocation list exists, prunes the expired tokens,
+// and reports the number of revoked tokens and the time the next one expires.
+func (r *GateServerReconciler) reconcileRevokedTokens(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	tokens, err := updateRevokedTokens(ctx, r.Client, r.Scheme, s, nil)
+	if err != nil {
+		return err
+	}
+
+	var next int64
+	for _, exp := range tokens {
+		if next == 0 || exp < next {
+			next = exp
+		}
+	}
+
+	s.Status.RevokedTokens = len(tokens)
+	s.Status.NextRevocationExpiry = nil
+	if next != 0 {
+		s.Status.NextRevocationExpiry = &metav1.Time{Time: time.Unix(next, 0)}
+	}
+
+	// Older gateway images do not read the revocation list, revoked tokens are valid until they expire
+	if extendedGateway(s) {
+		setServerCondition(s, metav1.Condition{
+			Type:    "RevocationEnforced",
+			Status:  metav1.ConditionTrue,
+			Reason:  "RevocationListMounted",
+			Message: "The gateway rejects the tokens in the revocation list",
+		})
+	} else {
+		setServerCondition(s, metav1.Condition{
+			Type:   "RevocationEnforced",
+			Status: metav1.ConditionFalse,
+			Reason: "GatewayVersionUnsupported",
+			Message: fmt.Sprintf("The gateway image does not read the revocation list, revoked tokens are valid until they expire. "+
+				"Token revocation requires kube-gateway %s or later, set the %s annotation when the image tag is not a version",
+				minExtendedGatewayVersion, gatewayVersionAnnotation),
+		})
+	}
+
+	return nil
+}
+
+// tokenGateServer returns the gate server a token is signed for, the referenced gate server, or the
+// gate server using the referenced secret as signing key. Returns nil if there is no such gate server.
+func (r *GateTokenReconciler) tokenGateServer(ctx context.Context, token *kubegatewayv1beta1.GateToken) (*kubegatewayv1beta1.GateServer, error) {
+	if token.Spec.GateServerRef != "" {
+		s := &kubegatewayv1beta1.GateServer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: token.Spec.GateServerRef, Namespace: token.Namespace}, s); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		return s, nil
+	}
+	if token.Spec.SecretName == "" {
+		return nil, nil
+	}
+
+	namespace := token.Spec.SecretNamespace
+	if namespace == "" {
+		namespace = token.Namespace
+	}
+	secret, err := getSecret(ctx, r.Client, token.Spec.SecretName, namespace)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return gateServerForSecret(ctx, r.Client, secret)
+}
+
+// revokeToken adds the signed token, and the tokens it superseded, to the revocation list of the gate
+// server the token is signed for. Returns the gate server, or nil if the token signing key is not used
+// by a gate server, or the gate server is deleted, and there is no revocation list to update.
+func (r *GateTokenReconciler) revokeToken(ctx context.Context, token *kubegatewayv1beta1.GateToken) (*kubegatewayv1beta1.GateServer, error) {
+	s, err := r.tokenGateServer(ctx, token)
+	if err != nil || s == nil || s.GetDeletionTimestamp() != nil {
+		return nil, err
+	}
+
+	revoked := map[string]int64{}
+	if token.Signed() && token.Status.Data.ID != "" {
+		revoked[token.Status.Data.ID] = token.Status.Data.Exp
+	}
+	for _, superseded := range token.Status.Superseded {
+		until, err := time.Parse(time.RFC3339, superseded.Until)
+		if superseded.ID == "" || err != nil {
+			continue
+		}
+		revoked[superseded.ID] = until.Unix()
+	}
+
+	_, err = updateRevokedTokens(ctx, r.Client, r.Scheme, s, revoked)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
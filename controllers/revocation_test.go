@@ -0,0 +1,136 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// revocationList returns the revocation list of the server
+func revocationList(s *kubegatewayv1beta1.GateServer) map[string]int64 {
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: revokedTokensConfigMapName(s)}}
+	Expect(getObject(s, configmap)).To(Succeed())
+
+	tokens := map[string]int64{}
+	Expect(json.Unmarshal([]byte(configmap.Data[revokedTokensFile]), &tokens)).To(Succeed())
+
+	return tokens
+}
+
+var _ = Describe("Token revocation", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+	})
+
+	It("reports a gateway image that does not enforce revocation", func() {
+		stored, _ := reconcileServer(r, s)
+		condition := meta.FindStatusCondition(stored.Status.Conditions, "RevocationEnforced")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("GatewayVersionUnsupported"))
+
+		stored.Annotations = map[string]string{gatewayVersionAnnotation: "v0.2.0"}
+		Expect(k8sClient.Update(context.Background(), stored)).To(Succeed())
+
+		stored, _ = reconcileServer(r, s)
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, "RevocationEnforced")).To(BeTrue())
+	})
+
+	It("does not report a revoked token the gateway does not reject as revoked", func() {
+		reconcileServer(r, s)
+
+		tr := newGateTokenReconciler()
+		token := newGateToken(s)
+		Expect(k8sClient.Create(context.Background(), token)).To(Succeed())
+		token = reconcileGateToken(tr, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+
+		token.Spec.Revoked = true
+		Expect(k8sClient.Update(context.Background(), token)).To(Succeed())
+		token = reconcileGateToken(tr, token)
+		Expect(token.Status.Phase).To(Equal("Error"))
+		condition := meta.FindStatusCondition(token.Status.Conditions, "Revoked")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("RevocationNotEnforced"))
+		Expect(revocationList(s)).To(HaveKey(token.Status.Data.ID))
+
+		// Revoked once the gateway image enforces revocation
+		stored := &kubegatewayv1beta1.GateServer{}
+		Expect(getObject(s, stored)).To(Succeed())
+		stored.Annotations = map[string]string{gatewayVersionAnnotation: "v0.2.0"}
+		Expect(k8sClient.Update(context.Background(), stored)).To(Succeed())
+
+		token = reconcileGateToken(tr, token)
+		Expect(token.Status.Phase).To(Equal("Revoked"))
+		Expect(meta.IsStatusConditionTrue(token.Status.Conditions, "Revoked")).To(BeTrue())
+	})
+
+	It("prunes the revoked tokens once they expire", func() {
+		ctx := context.Background()
+		now := time.Now()
+		_, err := updateRevokedTokens(ctx, k8sClient, r.Scheme, s, map[string]int64{
+			"expired": now.Add(-time.Minute).Unix(),
+			"valid":   now.Add(time.Hour).Unix(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revocationList(s)).To(Equal(map[string]int64{"valid": now.Add(time.Hour).Unix()}))
+		Expect(stored.Status.RevokedTokens).To(Equal(1))
+		Expect(stored.Status.NextRevocationExpiry.Unix()).To(Equal(now.Add(time.Hour).Unix()))
+	})
+
+	It("revokes a deleted token until it expires", func() {
+		ctx := context.Background()
+		reconcileServer(r, s)
+
+		tr := newGateTokenReconciler()
+		token := newGateToken(s)
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+		token = reconcileGateToken(tr, token)
+		Expect(token.Status.Phase).To(Equal("Ready"))
+		Expect(token.Status.Data.ID).NotTo(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, token)).To(Succeed())
+		_, err := tr.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(token)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(revocationList(s)).To(HaveKeyWithValue(token.Status.Data.ID, token.Status.Data.Exp))
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(token), &kubegatewayv1beta1.GateToken{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
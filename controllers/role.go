@@ -1,10 +1,15 @@
 package controllers
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
@@ -12,40 +17,148 @@ import (
 
 // Role creates a role resource
 func (r *GateServerReconciler) Role(s *kubegatewayv1beta1.GateServer) (*rbacv1.Role, error) {
-	var verbs []string
-	var resources []string
-
 	labels := map[string]string{
 		"app": s.Name,
 	}
 
-	if s.Spec.AdminRole == "admin" {
-		verbs = []string{"get", "list", "watch", "create", "delete", "patch", "update"}
-	} else {
-		verbs = []string{"get", "list", "watch"}
-	}
-	if s.Spec.AdminResources == "" {
-		resources = []string{"*"}
-	} else {
-		resources = strings.Split(s.Spec.AdminResources, ",")
-	}
-
 	role := &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      s.Name,
 			Namespace: s.Namespace,
 			Labels:    labels,
 		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{"*"},
-				Resources: resources,
-				Verbs:     verbs,
-			},
-		},
+		Rules: policyRules(s),
 	}
 
 	controllerutil.SetControllerReference(s, role, r.Scheme)
 
 	return role, nil
 }
+
+// TargetRole creates a role resource in a target namespace of the server
+// Roles outside the server namespace can not be owned by the server, they are
+// labeled with the server name and namespace instead.
+func (r *GateServerReconciler) TargetRole(s *kubegatewayv1beta1.GateServer, namespace string) (*rbacv1.Role, error) {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scopedName(s),
+			Namespace: namespace,
+			Labels:    gateServerLabels(s),
+		},
+		Rules: policyRules(s),
+	}
+
+	return role, nil
+}
+
+// policyRules returns the rules granted to the gate proxy server service account,
+// if the spec does not list rules, the admin-role and admin-resources fields are
+// converted to a rule.
+func policyRules(s *kubegatewayv1beta1.GateServer) []rbacv1.PolicyRule {
+	if len(s.Spec.Rules) > 0 {
+		return s.Spec.Rules
+	}
+
+	return legacyPolicyRules(s.Spec.AdminRole, s.Spec.AdminResources)
+}
+
+// legacyPolicyRules converts the admin-role verbs preset and the comma separated
+// admin-resources list to a policy rule matching all API groups.
+func legacyPolicyRules(adminRole string, adminResources string) []rbacv1.PolicyRule {
+	var verbs []string
+	var resources []string
+
+	if adminRole == "admin" {
+		verbs = []string{"get", "list", "watch", "create", "delete", "patch", "update"}
+	} else {
+		verbs = []string{"get", "list", "watch"}
+	}
+
+	for _, resource := range strings.Split(adminResources, ",") {
+		if resource = strings.TrimSpace(resource); resource != "" {
+			resources = append(resources, resource)
+		}
+	}
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"*"},
+			Resources: resources,
+			Verbs:     verbs,
+		},
+	}
+}
+
+// reconcileRole makes sure the role exists and matches the desired state,
+// when the server references an existing cluster role, the cluster role is checked
+// and no role is generated. A missing cluster role is reported using the ClusterRoleFound
+// condition, and is not bound until it is created.
+func (r *GateServerReconciler) reconcileRole(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	if s.Spec.ClusterRole != "" {
+		if err := r.checkClusterRole(ctx, s); err != nil {
+			return err
+		}
+
+		return r.deleteOwned(ctx, s, &rbacv1.Role{})
+	}
+	removeServerCondition(s, "ClusterRoleFound")
+
+	desired, err := r.Role(s)
+	if err != nil {
+		return err
+	}
+
+	return r.applyRole(ctx, s, desired, true)
+}
+
+// applyRole makes sure a role exists and matches the desired role,
+// owned roles are set to be controlled by the server.
+func (r *GateServerReconciler) applyRole(ctx context.Context, s *kubegatewayv1beta1.GateServer, desired *rbacv1.Role, owned bool) error {
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		role.Labels = mergeLabels(role.Labels, desired.Labels)
+		role.Rules = desired.Rules
+
+		if !owned {
+			return nil
+		}
+		return controllerutil.SetControllerReference(s, role, r.Scheme)
+	})
+
+	return err
+}
+
+// checkClusterRole checks that the cluster role referenced by the server exists
+func (r *GateServerReconciler) checkClusterRole(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	clusterrole := &rbacv1.ClusterRole{}
+	err := r.Get(ctx, types.NamespacedName{Name: s.Spec.ClusterRole}, clusterrole)
+	if errors.IsNotFound(err) {
+		setServerCondition(s, metav1.Condition{
+			Type:    "ClusterRoleFound",
+			Status:  metav1.ConditionFalse,
+			Reason:  "ClusterRoleNotFound",
+			Message: fmt.Sprintf("cluster role %s not found, it is bound to the gateway service account once created", s.Spec.ClusterRole),
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	setServerCondition(s, metav1.Condition{
+		Type:    "ClusterRoleFound",
+		Status:  metav1.ConditionTrue,
+		Reason:  "ClusterRoleFound",
+		Message: fmt.Sprintf("cluster role %s is bound to the gateway service account", s.Spec.ClusterRole),
+	})
+	return nil
+}
+
+// clusterRoleBound checks if the role bindings of the server should be created, the generated role
+// is always bound, a referenced cluster role only once it is found.
+func clusterRoleBound(s *kubegatewayv1beta1.GateServer) bool {
+	return s.Spec.ClusterRole == "" || !meta.IsStatusConditionFalse(s.Status.Conditions, "ClusterRoleFound")
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer role rules", func() {
+	readVerbs := []string{"get", "list", "watch"}
+	adminVerbs := []string{"get", "list", "watch", "create", "delete", "patch", "update"}
+
+	table.DescribeTable("converts the admin-role and admin-resources fields to a rule",
+		func(adminRole string, adminResources string, rule rbacv1.PolicyRule) {
+			Expect(legacyPolicyRules(adminRole, adminResources)).To(Equal([]rbacv1.PolicyRule{rule}))
+		},
+		table.Entry("a reader of all resources", "reader", "",
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: readVerbs}),
+		table.Entry("an admin of all resources", "admin", "",
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: adminVerbs}),
+		table.Entry("a reader of listed resources", "reader", "pods, virtualmachineinstances/vnc,,",
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"pods", "virtualmachineinstances/vnc"}, Verbs: readVerbs}),
+	)
+
+	It("grants the rules listed in the spec instead of the admin-role and admin-resources fields", func() {
+		rules := []rbacv1.PolicyRule{{
+			APIGroups:     []string{"subresources.kubevirt.io"},
+			Resources:     []string{"virtualmachineinstances/vnc"},
+			ResourceNames: []string{"testvm"},
+			Verbs:         []string{"get"},
+		}}
+		s := &kubegatewayv1beta1.GateServer{}
+		s.Spec.AdminRole = "admin"
+		s.Spec.Rules = rules
+
+		Expect(policyRules(s)).To(Equal(rules))
+	})
+
+	It("updates the role when the rules change", func() {
+		ctx := context.Background()
+		r := newGateServerReconciler()
+		s := newGateServer()
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		role := &rbacv1.Role{}
+		Expect(getObject(s, role)).To(Succeed())
+		Expect(role.Rules).To(Equal(legacyPolicyRules(s.Spec.AdminRole, s.Spec.AdminResources)))
+
+		stored.Spec.Rules = []rbacv1.PolicyRule{{
+			APIGroups: []string{"subresources.kubevirt.io"},
+			Resources: []string{"virtualmachineinstances/vnc", "virtualmachineinstances/console"},
+			Verbs:     []string{"get"},
+		}}
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		role = &rbacv1.Role{}
+		Expect(getObject(s, role)).To(Succeed())
+		Expect(role.Rules).To(Equal(stored.Spec.Rules))
+	})
+})
@@ -1,8 +1,13 @@
 package controllers
 
 import (
+	"context"
+	"fmt"
+
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
@@ -14,26 +19,132 @@ func (r *GateServerReconciler) RoleBinding(s *kubegatewayv1beta1.GateServer) (*r
 		"app": s.Name,
 	}
 
+	// Bind the generated role, or the cluster role referenced by the server
+	roleRef := rbacv1.RoleRef{
+		APIGroup: "rbac.authorization.k8s.io",
+		Kind:     "Role",
+		Name:     s.Name,
+	}
+	if s.Spec.ClusterRole != "" {
+		roleRef.Kind = "ClusterRole"
+		roleRef.Name = s.Spec.ClusterRole
+	}
+
 	rolebinding := &rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      s.Name,
 			Namespace: s.Namespace,
 			Labels:    labels,
 		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind: "ServiceAccount",
-				Name: s.Name,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     "Role",
-			Name:     s.Name,
-		},
+		Subjects: serviceAccountSubjects(s),
+		RoleRef:  roleRef,
 	}
 
 	controllerutil.SetControllerReference(s, rolebinding, r.Scheme)
 
 	return rolebinding, nil
 }
+
+// TargetRoleBinding creates a role binding resource in a target namespace of the server
+// Role bindings outside the server namespace can not be owned by the server, they are
+// labeled with the server name and namespace instead.
+func (r *GateServerReconciler) TargetRoleBinding(s *kubegatewayv1beta1.GateServer, namespace string) (*rbacv1.RoleBinding, error) {
+	roleRef := rbacv1.RoleRef{
+		APIGroup: "rbac.authorization.k8s.io",
+		Kind:     "Role",
+		Name:     scopedName(s),
+	}
+	if s.Spec.ClusterRole != "" {
+		roleRef.Kind = "ClusterRole"
+		roleRef.Name = s.Spec.ClusterRole
+	}
+
+	rolebinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scopedName(s),
+			Namespace: namespace,
+			Labels:    gateServerLabels(s),
+		},
+		Subjects: serviceAccountSubjects(s),
+		RoleRef:  roleRef,
+	}
+
+	return rolebinding, nil
+}
+
+// serviceAccountSubjects returns the gate proxy server service account as a binding subject
+func serviceAccountSubjects(s *kubegatewayv1beta1.GateServer) []rbacv1.Subject {
+	return []rbacv1.Subject{
+		{
+			Kind:      "ServiceAccount",
+			Name:      s.Name,
+			Namespace: s.Namespace,
+		},
+	}
+}
+
+// reconcileRoleBinding makes sure the role binding exists and matches the desired state,
+// the role binding of a missing cluster role is removed.
+func (r *GateServerReconciler) reconcileRoleBinding(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	if !clusterRoleBound(s) {
+		return r.deleteOwned(ctx, s, &rbacv1.RoleBinding{})
+	}
+
+	desired, err := r.RoleBinding(s)
+	if err != nil {
+		return err
+	}
+
+	return r.applyRoleBinding(ctx, s, desired, true)
+}
+
+// applyRoleBinding makes sure a role binding exists and matches the desired role binding,
+// owned role bindings are set to be controlled by the server.
+func (r *GateServerReconciler) applyRoleBinding(ctx context.Context, s *kubegatewayv1beta1.GateServer, desired *rbacv1.RoleBinding, owned bool) error {
+	// Role reference is immutable, re-create the role binding if it changed
+	rolebinding := &rbacv1.RoleBinding{}
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, rolebinding)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && rolebinding.RoleRef != desired.RoleRef {
+		r.Log.Info("Role reference changed, re-create rolebinding.", "rolebinding", desired.Name, "namespace", desired.Namespace)
+		if err := r.Delete(ctx, rolebinding); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+
+		// The cached client may still hold the deleted role binding, create it directly
+		rolebinding = &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+			Name:      desired.Name,
+			Namespace: desired.Namespace,
+			Labels:    desired.Labels,
+		}}
+		rolebinding.Subjects = desired.Subjects
+		rolebinding.RoleRef = desired.RoleRef
+		if owned {
+			if err := controllerutil.SetControllerReference(s, rolebinding, r.Scheme); err != nil {
+				return err
+			}
+		}
+
+		err := r.Create(ctx, rolebinding)
+		if errors.IsAlreadyExists(err) {
+			return fmt.Errorf("rolebinding %s/%s is still being deleted, retry re-creating it", desired.Namespace, desired.Name)
+		}
+		return err
+	}
+
+	rolebinding = &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, rolebinding, func() error {
+		rolebinding.Labels = mergeLabels(rolebinding.Labels, desired.Labels)
+		rolebinding.Subjects = desired.Subjects
+		rolebinding.RoleRef = desired.RoleRef
+
+		if !owned {
+			return nil
+		}
+		return controllerutil.SetControllerReference(s, rolebinding, r.Scheme)
+	})
+
+	return err
+}
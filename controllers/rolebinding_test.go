@@ -0,0 +1,71 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// pendingDeleteClient keeps deleted objects, as a role binding whose deletion is not yet done
+type pendingDeleteClient struct {
+	client.Client
+}
+
+func (c *pendingDeleteClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return nil
+}
+
+var _ = Describe("GateServer role binding", func() {
+	It("re-creates the role binding when the role reference changes", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(kubegatewayv1beta1.AddToScheme(scheme)).To(Succeed())
+
+		s := &kubegatewayv1beta1.GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: "ns"}}
+		s.Spec.ClusterRole = "view"
+		existing := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: s.Name},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(s, existing).Build()
+		r := &GateServerReconciler{Client: c, Scheme: scheme, Log: ctrl.Log.WithName("test")}
+
+		// A role binding still being deleted is retried
+		pending := &GateServerReconciler{Client: &pendingDeleteClient{c}, Scheme: scheme, Log: ctrl.Log.WithName("test")}
+		Expect(pending.reconcileRoleBinding(context.Background(), s)).NotTo(Succeed())
+
+		Expect(r.reconcileRoleBinding(context.Background(), s)).To(Succeed())
+		rolebinding := &rbacv1.RoleBinding{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(existing), rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Kind).To(Equal("ClusterRole"))
+		Expect(rolebinding.RoleRef.Name).To(Equal("view"))
+		Expect(metav1.IsControlledBy(rolebinding, s)).To(BeTrue())
+	})
+})
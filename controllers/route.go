@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"context"
+
 	routev1 "github.com/openshift/api/route/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -41,3 +43,35 @@ func (r *GateServerReconciler) Route(s *kubegatewayv1beta1.GateServer) (*routev1
 
 	return route, nil
 }
+
+// reconcileRoute makes sure the route exists and matches the desired state
+func (r *GateServerReconciler) reconcileRoute(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.Route(s)
+	if err != nil {
+		return err
+	}
+
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+		route.Labels = mergeLabels(route.Labels, desired.Labels)
+		route.Spec.Host = desired.Spec.Host
+		route.Spec.To.Kind = desired.Spec.To.Kind
+		route.Spec.To.Name = desired.Spec.To.Name
+		route.Spec.TLS = desired.Spec.TLS
+
+		// Routes trust the service-ca by default, other providers need the CA set explicitly
+		if r.certProviderName(s) != certProviderServiceCA {
+			ca, err := r.servingCA(ctx, s)
+			if err != nil {
+				return err
+			}
+			route.Spec.TLS.DestinationCACertificate = ca
+		}
+		route.Spec.Port = desired.Spec.Port
+		route.Spec.WildcardPolicy = desired.Spec.WildcardPolicy
+
+		return controllerutil.SetControllerReference(s, route, r.Scheme)
+	})
+
+	return err
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Permission scopes
+const (
+	scopeNamespace = "Namespace"
+	scopeCluster   = "Cluster"
+)
+
+// Labels identifying resources created by a server that can not be owned by it,
+// e.g. cluster scoped resources and resources in other namespaces.
+const (
+	gateServerNameLabel      = "kubegateway.kubevirt.io/gateserver-name"
+	gateServerNamespaceLabel = "kubegateway.kubevirt.io/gateserver-namespace"
+)
+
+// scopedName is a cluster unique name for resources created outside the server namespace
+func scopedName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("kube-gateway-%s-%s", s.Namespace, s.Name)
+}
+
+// gateServerLabels labels resources created outside the server namespace
+func gateServerLabels(s *kubegatewayv1beta1.GateServer) map[string]string {
+	return map[string]string{
+		"app":                    s.Name,
+		gateServerNameLabel:      s.Name,
+		gateServerNamespaceLabel: s.Namespace,
+	}
+}
+
+// gateServerSelector selects resources created outside the server namespace
+func gateServerSelector(s *kubegatewayv1beta1.GateServer) client.MatchingLabels {
+	return client.MatchingLabels{
+		gateServerNameLabel:      s.Name,
+		gateServerNamespaceLabel: s.Namespace,
+	}
+}
+
+// gateServerForLabels maps a resource labeled with a server name and namespace to the server
+func gateServerForLabels(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels[gateServerNameLabel] == "" || labels[gateServerNamespaceLabel] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: labels[gateServerNameLabel], Namespace: labels[gateServerNamespaceLabel]}},
+	}
+}
+
+// reconcileScope grants the gate proxy server permissions outside the server namespace,
+// using role bindings in the target namespaces, or a cluster role binding when the
+// scope is Cluster. Permissions no longer in scope, or of a missing cluster role, are removed.
+func (r *GateServerReconciler) reconcileScope(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	bound := clusterRoleBound(s)
+	clusterScope := bound && s.Spec.Scope == scopeCluster
+
+	// Target namespaces
+	namespaces := map[string]bool{}
+	if bound && !clusterScope {
+		for _, namespace := range s.Spec.TargetNamespaces {
+			if namespace != s.Namespace {
+				namespaces[namespace] = true
+			}
+		}
+	}
+
+	for _, namespace := range s.Spec.TargetNamespaces {
+		if !namespaces[namespace] {
+			continue
+		}
+
+		if s.Spec.ClusterRole == "" {
+			role, err := r.TargetRole(s, namespace)
+			if err != nil {
+				return err
+			}
+			if err := r.applyRole(ctx, s, role, false); err != nil {
+				return err
+			}
+		}
+
+		rolebinding, err := r.TargetRoleBinding(s, namespace)
+		if err != nil {
+			return err
+		}
+		if err := r.applyRoleBinding(ctx, s, rolebinding, false); err != nil {
+			return err
+		}
+	}
+
+	// Remove role bindings and roles from namespaces no longer targeted
+	rolebindings := &rbacv1.RoleBindingList{}
+	if err := r.List(ctx, rolebindings, gateServerSelector(s)); err != nil {
+		return err
+	}
+	for i := range rolebindings.Items {
+		if !namespaces[rolebindings.Items[i].Namespace] {
+			if err := r.deleteScoped(ctx, &rolebindings.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	roles := &rbacv1.RoleList{}
+	if err := r.List(ctx, roles, gateServerSelector(s)); err != nil {
+		return err
+	}
+	for i := range roles.Items {
+		if !namespaces[roles.Items[i].Namespace] || s.Spec.ClusterRole != "" {
+			if err := r.deleteScoped(ctx, &roles.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Cluster scope
+	if clusterScope {
+		if err := r.applyClusterScope(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	clusterrolebindings := &rbacv1.ClusterRoleBindingList{}
+	if err := r.List(ctx, clusterrolebindings, gateServerSelector(s)); err != nil {
+		return err
+	}
+	for i := range clusterrolebindings.Items {
+		if !clusterScope {
+			if err := r.deleteScoped(ctx, &clusterrolebindings.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	clusterroles := &rbacv1.ClusterRoleList{}
+	if err := r.List(ctx, clusterroles, gateServerSelector(s)); err != nil {
+		return err
+	}
+	for i := range clusterroles.Items {
+		if !clusterScope || s.Spec.ClusterRole != "" {
+			if err := r.deleteScoped(ctx, &clusterroles.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyClusterScope makes sure the cluster role and cluster role binding exist and match the desired state
+func (r *GateServerReconciler) applyClusterScope(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	if s.Spec.ClusterRole == "" {
+		desired, err := r.ClusterRole(s)
+		if err != nil {
+			return err
+		}
+
+		clusterrole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: desired.Name}}
+		_, err = controllerutil.CreateOrUpdate(ctx, r.Client, clusterrole, func() error {
+			clusterrole.Labels = mergeLabels(clusterrole.Labels, desired.Labels)
+			clusterrole.Rules = desired.Rules
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	desired, err := r.ClusterRoleBinding(s)
+	if err != nil {
+		return err
+	}
+
+	// Role reference is immutable, re-create the cluster role binding if it changed
+	clusterrolebinding := &rbacv1.ClusterRoleBinding{}
+	err = r.Get(ctx, types.NamespacedName{Name: desired.Name}, clusterrolebinding)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && clusterrolebinding.RoleRef != desired.RoleRef {
+		r.Log.Info("Role reference changed, re-create clusterrolebinding.", "clusterrolebinding", desired.Name)
+		if err := r.deleteScoped(ctx, clusterrolebinding); err != nil {
+			return err
+		}
+	}
+
+	clusterrolebinding = &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: desired.Name}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, clusterrolebinding, func() error {
+		clusterrolebinding.Labels = mergeLabels(clusterrolebinding.Labels, desired.Labels)
+		clusterrolebinding.Subjects = desired.Subjects
+		clusterrolebinding.RoleRef = desired.RoleRef
+		return nil
+	})
+
+	return err
+}
+
+// deleteScoped deletes a resource created outside the server namespace
+func (r *GateServerReconciler) deleteScoped(ctx context.Context, obj client.Object) error {
+	r.Log.Info("Delete resource out of scope.", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("GateServer scope", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+	var target string
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = newGateServer()
+		target = createNamespace()
+		s.Spec.TargetNamespaces = []string{target}
+		Expect(k8sClient.Create(context.Background(), s)).To(Succeed())
+	})
+
+	// scoped returns a resource created by the server outside its namespace
+	scoped := func(obj metav1.Object, namespace string) {
+		obj.SetName(scopedName(s))
+		obj.SetNamespace(namespace)
+	}
+
+	It("grants the gateway permissions in the target namespaces", func() {
+		_, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		role := &rbacv1.Role{}
+		scoped(role, target)
+		Expect(getObject(s, role)).To(Succeed())
+		Expect(role.Rules).To(Equal(policyRules(s)))
+		Expect(role.Labels).To(HaveKeyWithValue(gateServerNamespaceLabel, s.Namespace))
+		Expect(role.OwnerReferences).To(BeEmpty())
+
+		rolebinding := &rbacv1.RoleBinding{}
+		scoped(rolebinding, target)
+		Expect(getObject(s, rolebinding)).To(Succeed())
+		Expect(rolebinding.RoleRef.Kind).To(Equal("Role"))
+		Expect(rolebinding.RoleRef.Name).To(Equal(role.Name))
+		Expect(rolebinding.Subjects).To(Equal(serviceAccountSubjects(s)))
+	})
+
+	It("removes the permissions of a namespace no longer targeted", func() {
+		ctx := context.Background()
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored.Spec.TargetNamespaces = nil
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		role := &rbacv1.Role{}
+		scoped(role, target)
+		Expect(errors.IsNotFound(getObject(s, role))).To(BeTrue())
+		rolebinding := &rbacv1.RoleBinding{}
+		scoped(rolebinding, target)
+		Expect(errors.IsNotFound(getObject(s, rolebinding))).To(BeTrue())
+	})
+
+	It("grants the gateway permissions in all namespaces when the scope is Cluster", func() {
+		ctx := context.Background()
+		stored, err := reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored.Spec.Scope = scopeCluster
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterrole := &rbacv1.ClusterRole{}
+		scoped(clusterrole, "")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterrole), clusterrole)).To(Succeed())
+		Expect(clusterrole.Rules).To(Equal(policyRules(s)))
+
+		clusterrolebinding := &rbacv1.ClusterRoleBinding{}
+		scoped(clusterrolebinding, "")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterrolebinding), clusterrolebinding)).To(Succeed())
+		Expect(clusterrolebinding.RoleRef.Name).To(Equal(clusterrole.Name))
+		Expect(clusterrolebinding.Subjects).To(Equal(serviceAccountSubjects(s)))
+
+		// Target namespaces are covered by the cluster role binding
+		rolebinding := &rbacv1.RoleBinding{}
+		scoped(rolebinding, target)
+		Expect(errors.IsNotFound(getObject(s, rolebinding))).To(BeTrue())
+
+		// Back to the Namespace scope, the cluster role and binding are removed
+		stored = &kubegatewayv1beta1.GateServer{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(s), stored)).To(Succeed())
+		stored.Spec.Scope = scopeNamespace
+		Expect(k8sClient.Update(ctx, stored)).To(Succeed())
+		_, err = reconcileServer(r, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterrolebinding), &rbacv1.ClusterRoleBinding{}))).To(BeTrue())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterrole), &rbacv1.ClusterRole{}))).To(BeTrue())
+		Expect(getObject(s, rolebinding)).To(Succeed())
+	})
+})
@@ -17,11 +17,14 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -37,37 +40,180 @@ func (r *GateServerReconciler) Secret(s *kubegatewayv1beta1.GateServer) (*corev1
 		"app": s.Name,
 	}
 
-	bitSize := 4096
+	params := signingKeyParamsOf(s)
+	policy, err := keyRotationPolicyOf(s)
+	if err != nil {
+		return nil, err
+	}
 
-	privateKey, err := generatePrivateKey(bitSize)
+	privateKey, err := generateSigningKey(params)
 	if err != nil {
 		return nil, err
 	}
 
-	publicKeyBytes, err := encodePublicKeyToPEM(&privateKey.PublicKey)
+	publicKeyBlock, err := publicKeyToPEMBlock(privateKey.Public(), params.algorithm, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	privateKeyBytes := encodePrivateKeyToPEM(privateKey)
+	privateKeyBytes, err := encodePrivateKeyToPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-jwt-secret", s.Name),
+			Name:      jwtSecretName(s),
 			Namespace: s.Namespace,
 			Labels:    labels,
+			Annotations: map[string]string{
+				signingAlgorithmAnnotation: params.algorithm,
+			},
 		},
 		Data: map[string][]byte{
-			"tls.crt": publicKeyBytes,
-			"tls.key": privateKeyBytes,
+			publicKeysFile:        pem.EncodeToMemory(publicKeyBlock),
+			defaultSigningKeyFile: privateKeyBytes,
 		},
 	}
 
+	// Certificate used by the gateway to verify tokens
+	if err := issueJWTCertificates(s, secret, signingSecretOf(s), policy); err != nil {
+		return nil, err
+	}
+
 	controllerutil.SetControllerReference(s, secret, r.Scheme)
 
 	return secret, nil
 }
 
+// reconcileSecret makes sure the JWT secret exists and holds a valid key pair,
+// existing keys are kept, a new key pair is only generated when the secret is
+// missing or it's keys can not be parsed, or when the key rotation policy or
+// the signing algorithm requires a new signing key.
+// When the spec references a user supplied signing key, the key is validated and
+// no key is generated. When the spec references an external signer, the secret
+// holds only the signer public keys.
+func (r *GateServerReconciler) reconcileSecret(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	setKeyRotationCondition(s)
+
+	if s.Spec.ExternalSigner != nil {
+		return r.reconcileExternalSigner(ctx, s)
+	}
+	if s.Spec.SigningKey != nil {
+		return r.reconcileSigningKeyRef(ctx, s)
+	}
+
+	policy, err := keyRotationPolicyOf(s)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jwtSecretName(s),
+			Namespace: s.Namespace,
+		},
+	}
+
+	params := signingKeyParamsOf(s)
+	ref := signingSecretOf(s)
+
+	now := time.Now()
+	tokens, err := r.signedTokenExpiry(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = mergeLabels(secret.Labels, map[string]string{"app": s.Name})
+
+		if !hasValidKeyPair(secret, ref) {
+			r.Log.Info("Create JWT key pair.", "secret", secret.Name)
+
+			desired, err := r.Secret(s)
+			if err != nil {
+				return err
+			}
+			secret.Data = desired.Data
+		}
+
+		if err := r.rotateSigningKey(secret, ref, params, policy, tokens, now); err != nil {
+			return err
+		}
+		if err := issueJWTCertificates(s, secret, ref, policy); err != nil {
+			return err
+		}
+
+		return controllerutil.SetControllerReference(s, secret, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Status.SigningKeys, s.Status.NextKeyRotation = signingKeysStatus(secret, ref, policy, tokens)
+	return nil
+}
+
+// setKeyRotationCondition reports whether the key rotation policy is applied, older gateway images
+// read only the first public key, and reject tokens signed by a retired key during the grace period.
+func setKeyRotationCondition(s *kubegatewayv1beta1.GateServer) {
+	if s.Spec.KeyRotation == nil || s.Spec.SigningKey != nil || s.Spec.ExternalSigner != nil {
+		removeServerCondition(s, "KeyRotationEnabled")
+		return
+	}
+
+	if !extendedGateway(s) {
+		setServerCondition(s, metav1.Condition{
+			Type:   "KeyRotationEnabled",
+			Status: metav1.ConditionFalse,
+			Reason: "GatewayVersionUnsupported",
+			Message: fmt.Sprintf("The gateway image verifies tokens using only the active signing key, the signing key is not rotated. "+
+				"Key rotation requires kube-gateway %s or later, set the %s annotation when the image tag is not a version",
+				minExtendedGatewayVersion, gatewayVersionAnnotation),
+		})
+		return
+	}
+
+	setServerCondition(s, metav1.Condition{
+		Type:    "KeyRotationEnabled",
+		Status:  metav1.ConditionTrue,
+		Reason:  "KeyRotationPolicySet",
+		Message: "The signing key is rotated, retired keys are kept until the tokens they signed expire",
+	})
+}
+
+// reconcileSigningKeyRef validates the user supplied signing key, and removes the
+// signing key previously generated by the operator.
+func (r *GateServerReconciler) reconcileSigningKeyRef(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	secret, ref, err := r.getSigningSecret(ctx, s)
+	if err != nil {
+		return err
+	}
+	if err := validateSigningKey(secret, ref, signingKeyParamsOf(s).algorithm); err != nil {
+		return err
+	}
+
+	generated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: jwtSecretName(s), Namespace: s.Namespace}}
+	if err := r.deleteOwned(ctx, s, generated); err != nil {
+		return err
+	}
+
+	s.Status.SigningKeys, s.Status.NextKeyRotation = signingKeysStatus(secret, ref, keyRotationPolicy{}, nil)
+	return nil
+}
+
+// hasValidKeyPair checks that the secret holds a parsable private and public key
+func hasValidKeyPair(secret *corev1.Secret, ref signingSecret) bool {
+	if _, err := parsePrivateKeyPEM(secret.Data[ref.keyFile]); err != nil {
+		return false
+	}
+	if len(ref.publicKeys(secret)) == 0 {
+		return false
+	}
+
+	return true
+}
+
 // generatePrivateKey creates a RSA Private Key of specified byte size
 func generatePrivateKey(bitSize int) (*rsa.PrivateKey, error) {
 	// Private Key generation
@@ -85,14 +231,17 @@ func generatePrivateKey(bitSize int) (*rsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// encodePrivateKeyToPEM encodes Private Key from RSA to PEM format
-func encodePrivateKeyToPEM(privateKey *rsa.PrivateKey) []byte {
+// encodePrivateKeyToPEM encodes a private key to PKCS#8 PEM format
+func encodePrivateKeyToPEM(privateKey crypto.Signer) ([]byte, error) {
 	// Get ASN.1 DER format
-	privDER := x509.MarshalPKCS1PrivateKey(privateKey)
+	privDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
 
 	// pem.Block
 	privBlock := pem.Block{
-		Type:    "RSA PRIVATE KEY",
+		Type:    "PRIVATE KEY",
 		Headers: nil,
 		Bytes:   privDER,
 	}
@@ -100,11 +249,12 @@ func encodePrivateKeyToPEM(privateKey *rsa.PrivateKey) []byte {
 	// Private key in PEM format
 	privatePEM := pem.EncodeToMemory(&privBlock)
 
-	return privatePEM
+	return privatePEM, nil
 }
 
-// encodePublicKeyToPEM encodes public Key from RSA to PEM format
-func encodePublicKeyToPEM(pubkey *rsa.PublicKey) ([]byte, error) {
+// publicKeyToPEMBlock encodes a public key to a PEM block, the block
+// headers record the key signing algorithm and the time the key was created.
+func publicKeyToPEMBlock(pubkey crypto.PublicKey, algorithm string, created time.Time) (*pem.Block, error) {
 	// Get ASN.1 DER format
 	pubDER, err := x509.MarshalPKIXPublicKey(pubkey)
 	if err != nil {
@@ -112,13 +262,52 @@ func encodePublicKeyToPEM(pubkey *rsa.PublicKey) ([]byte, error) {
 	}
 
 	// pem.Block
-	pubBlock := pem.Block{
-		Type:  "CERTIFICATE",
+	pubBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
 		Bytes: pubDER,
+		Headers: map[string]string{
+			keyAlgorithmHeader: algorithm,
+			keyCreatedHeader:   created.UTC().Format(time.RFC3339),
+		},
+	}
+
+	return pubBlock, nil
+}
+
+// reconcileExternalSigner stores the public keys of the external signer in the JWT secret,
+// used by the gateway to verify tokens, the private key is never stored in the cluster.
+func (r *GateServerReconciler) reconcileExternalSigner(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	algorithm := signingKeyParamsOf(s).algorithm
+
+	transit, err := vaultTransitFor(ctx, r.Client, s)
+	if err != nil {
+		return err
+	}
+	publicKeys, err := externalSignerPublicKeys(ctx, transit, algorithm)
+	if err != nil {
+		return err
 	}
 
-	// public key in PEM format
-	pubPEM := pem.EncodeToMemory(&pubBlock)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jwtSecretName(s),
+			Namespace: s.Namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = mergeLabels(secret.Labels, map[string]string{"app": s.Name})
+		secret.Annotations = mergeLabels(secret.Annotations, map[string]string{signingAlgorithmAnnotation: algorithm})
+		secret.Data = map[string][]byte{
+			defaultSigningCertFile: publicKeys,
+			publicKeysFile:         publicKeys,
+		}
+
+		return controllerutil.SetControllerReference(s, secret, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
 
-	return pubPEM, nil
+	s.Status.SigningKeys, s.Status.NextKeyRotation = signingKeysStatus(secret, signingSecretOf(s), keyRotationPolicy{}, nil)
+	return nil
 }
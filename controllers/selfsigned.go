@@ -0,0 +1,240 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+const (
+	// selfSignedCAValidity is the validity of the operator managed CA
+	selfSignedCAValidity = 5 * 365 * 24 * time.Hour
+
+	// selfSignedCertValidity is the validity of the serving certificate
+	selfSignedCertValidity = 90 * 24 * time.Hour
+)
+
+// selfSignedProvider issues the serving certificate using a CA managed by the operator,
+// the CA is stored in the "<name>-ca" secret, certificates are renewed when less than
+// a third of their validity is left.
+type selfSignedProvider struct {
+	r *GateServerReconciler
+}
+
+func (p *selfSignedProvider) serviceAnnotations(s *kubegatewayv1beta1.GateServer) map[string]string {
+	return map[string]string{}
+}
+
+func (p *selfSignedProvider) reconcile(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	r := p.r
+	labels := map[string]string{
+		"app": s.Name,
+	}
+
+	// Make sure the CA exists and is valid
+	ca := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-ca", s.Name),
+			Namespace: s.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, ca, func() error {
+		ca.Labels = mergeLabels(ca.Labels, labels)
+		ca.Type = corev1.SecretTypeTLS
+
+		if needsRenewal(ca.Data[corev1.TLSCertKey]) {
+			r.Log.Info("Create serving CA.", "secret", ca.Name)
+
+			certPEM, keyPEM, err := generateCA(fmt.Sprintf("%s.%s-ca", s.Name, s.Namespace))
+			if err != nil {
+				return err
+			}
+			ca.Data = map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+			}
+		}
+
+		return controllerutil.SetControllerReference(s, ca, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	caCert, err := parseCertificate(ca.Data[corev1.TLSCertKey])
+	if err != nil {
+		return err
+	}
+	caKey, err := parseECPrivateKey(ca.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return err
+	}
+
+	// Issue the serving certificate
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      servingCertSecretName(s),
+			Namespace: s.Namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = mergeLabels(secret.Labels, labels)
+		secret.Type = corev1.SecretTypeTLS
+
+		// Re-issue the certificate when it's about to expire, the CA changed or the host names changed
+		current, _ := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if needsRenewal(secret.Data[corev1.TLSCertKey]) || current.CheckSignatureFrom(caCert) != nil ||
+			!reflect.DeepEqual(current.DNSNames, servingDNSNames(s)) {
+			r.Log.Info("Issue serving certificate.", "secret", secret.Name)
+
+			certPEM, keyPEM, err := generateServingCert(caCert, caKey, servingDNSNames(s))
+			if err != nil {
+				return err
+			}
+			secret.Data = map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+				"ca.crt":                ca.Data[corev1.TLSCertKey],
+			}
+		}
+
+		return controllerutil.SetControllerReference(s, secret, r.Scheme)
+	})
+
+	return err
+}
+
+// servingDNSNames are the host names the gateway is accessed by
+func servingDNSNames(s *kubegatewayv1beta1.GateServer) []string {
+	names := []string{
+		s.Name,
+		fmt.Sprintf("%s.%s.svc", s.Name, s.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", s.Name, s.Namespace),
+	}
+	if s.Spec.Route != "" {
+		names = append(names, s.Spec.Route)
+	}
+
+	return names
+}
+
+// needsRenewal checks if a certificate is missing, or if less than a third of it's validity is left
+func needsRenewal(certPEM []byte) bool {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return true
+	}
+
+	return time.Now().After(certRenewalTime(cert.NotBefore, cert.NotAfter))
+}
+
+// certRenewalTime returns the time a certificate should be renewed
+func certRenewalTime(notBefore time.Time, notAfter time.Time) time.Time {
+	return notAfter.Add(-notAfter.Sub(notBefore) / 3)
+}
+
+// generateCA creates a self signed CA certificate and key in PEM format
+func generateCA(commonName string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(selfSignedCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	return createCertificate(template, template, &key.PublicKey, key, key)
+}
+
+// generateServingCert creates a serving certificate and key signed by the CA in PEM format
+func generateServingCert(ca *x509.Certificate, caKey crypto.Signer, dnsNames []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(selfSignedCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	return createCertificate(template, ca, &key.PublicKey, caKey, key)
+}
+
+// createCertificate signs a certificate template, and returns the certificate and key in PEM format
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// parseECPrivateKey parses an EC private key in PEM format
+func parseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// newSerialNumber returns a random certificate serial number
+func newSerialNumber() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
@@ -17,7 +17,7 @@ limitations under the License.
 package controllers
 
 import (
-	"fmt"
+	"context"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -33,9 +33,7 @@ func (r *GateServerReconciler) Service(s *kubegatewayv1beta1.GateServer) (*corev
 	labels := map[string]string{
 		"app": s.Name,
 	}
-	annotations := map[string]string{
-		"service.alpha.openshift.io/serving-cert-secret-name": fmt.Sprintf("%s-secret", s.Name),
-	}
+	annotations := r.certProvider(s).serviceAnnotations(s)
 
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -61,3 +59,37 @@ func (r *GateServerReconciler) Service(s *kubegatewayv1beta1.GateServer) (*corev
 
 	return service, nil
 }
+
+// reconcileService makes sure the service exists and matches the desired state
+func (r *GateServerReconciler) reconcileService(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.Service(s)
+	if err != nil {
+		return err
+	}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = mergeLabels(service.Labels, desired.Labels)
+		service.Annotations = mergeLabels(service.Annotations, desired.Annotations)
+		if r.certProviderName(s) != certProviderServiceCA {
+			delete(service.Annotations, "service.alpha.openshift.io/serving-cert-secret-name")
+		}
+		service.Spec.Selector = desired.Spec.Selector
+		service.Spec.Type = desired.Spec.Type
+
+		// Keep the node ports allocated by the cluster
+		ports := desired.Spec.Ports
+		for i := range ports {
+			for _, existing := range service.Spec.Ports {
+				if existing.Port == ports[i].Port && existing.Protocol == ports[i].Protocol {
+					ports[i].NodePort = existing.NodePort
+				}
+			}
+		}
+		service.Spec.Ports = ports
+
+		return controllerutil.SetControllerReference(s, service, r.Scheme)
+	})
+
+	return err
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
@@ -34,3 +35,37 @@ func (r *GateServerReconciler) ServiceAccount(s *kubegatewayv1beta1.GateServer)
 
 	return serviceaccount, nil
 }
+
+// reconcileServiceAccount makes sure the service account exists and matches the desired state,
+// secrets added to the service account by the cluster are kept.
+func (r *GateServerReconciler) reconcileServiceAccount(ctx context.Context, s *kubegatewayv1beta1.GateServer) error {
+	desired, err := r.ServiceAccount(s)
+	if err != nil {
+		return err
+	}
+
+	serviceaccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, serviceaccount, func() error {
+		serviceaccount.Labels = mergeLabels(serviceaccount.Labels, desired.Labels)
+
+		for _, ref := range desired.Secrets {
+			if !hasSecretReference(serviceaccount.Secrets, ref.Name) {
+				serviceaccount.Secrets = append(serviceaccount.Secrets, ref)
+			}
+		}
+
+		return controllerutil.SetControllerReference(s, serviceaccount, r.Scheme)
+	})
+
+	return err
+}
+
+func hasSecretReference(refs []corev1.ObjectReference, name string) bool {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
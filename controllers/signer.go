@@ -0,0 +1,165 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// Signer signs JWT tokens
+type Signer interface {
+	// Algorithm is the JWT signing algorithm, set in the "alg" header of signed tokens
+	Algorithm() string
+
+	// KeyID identifies the public key verifying the signature, set in the "kid" header of signed tokens
+	KeyID() string
+
+	// Sign returns the signature of the JWT signing input
+	Sign(ctx context.Context, signingInput string) ([]byte, error)
+}
+
+// secretSigner signs tokens in-process, using a private key read from a secret
+type secretSigner struct {
+	key       crypto.Signer
+	algorithm string
+	kid       string
+}
+
+// newSecretSigner creates a signer using the private key in the secret file entry, when the
+// signing algorithm is empty it is read from the secret or derived from the key type.
+func newSecretSigner(secret *corev1.Secret, file string, algorithm string) (*secretSigner, error) {
+	key, err := parsePrivateKeyPEM(secret.Data[file])
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm == "" {
+		algorithm = secretAlgorithm(secret, key)
+	}
+	if !keyMatchesAlgorithm(key.Public(), algorithm) {
+		return nil, fmt.Errorf("private key type %T can not be used by the %s signing algorithm", key, algorithm)
+	}
+
+	kid, err := keyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretSigner{key: key, algorithm: algorithm, kid: kid}, nil
+}
+
+// Algorithm implements Signer
+func (s *secretSigner) Algorithm() string {
+	return s.algorithm
+}
+
+// KeyID implements Signer
+func (s *secretSigner) KeyID() string {
+	return s.kid
+}
+
+// Sign implements Signer
+func (s *secretSigner) Sign(ctx context.Context, signingInput string) ([]byte, error) {
+	method, err := jwtSigningMethod(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := method.Sign(signingInput, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.DecodeSegment(signature)
+}
+
+// gateServerForSecret returns the gate server using the secret as signing key, the server
+// controlling the generated secret, or a server referencing a user supplied secret.
+// Returns nil if no gate server uses the secret.
+func gateServerForSecret(ctx context.Context, c client.Client, secret *corev1.Secret) (*kubegatewayv1beta1.GateServer, error) {
+	if owner := metav1.GetControllerOf(secret); owner != nil && owner.Kind == "GateServer" {
+		s := &kubegatewayv1beta1.GateServer{}
+		if err := c.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: secret.Namespace}, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	gateservers := &kubegatewayv1beta1.GateServerList{}
+	if err := c.List(ctx, gateservers, client.InNamespace(secret.Namespace)); err != nil {
+		return nil, err
+	}
+	for i := range gateservers.Items {
+		if signingSecretOf(&gateservers.Items[i]).name == secret.Name {
+			return &gateservers.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// signerForSecret returns the signer of tokens referencing the secret, s is the gate server using
+// the secret (see gateServerForSecret), or nil. When a gate server uses the secret, tokens are signed
+// using the server external signer, or using the key entry and algorithm set by the server; otherwise
+// the requested entry of the secret is used.
+func signerForSecret(ctx context.Context, c client.Client, s *kubegatewayv1beta1.GateServer, secret *corev1.Secret, file string) (Signer, error) {
+	if s == nil {
+		return newSecretSigner(secret, file, "")
+	}
+
+	if s.Spec.ExternalSigner != nil {
+		return signerForGateServer(ctx, c, s)
+	}
+
+	ref := signingSecretOf(s)
+	if file == "" || file == defaultSigningKeyFile {
+		file = ref.keyFile
+	}
+
+	return newSecretSigner(secret, file, signingKeyParamsOf(s).algorithm)
+}
+
+// signerForGateServer returns the signer of tokens of a gate server, using the server
+// external signer, or the server signing key and algorithm.
+func signerForGateServer(ctx context.Context, c client.Client, s *kubegatewayv1beta1.GateServer) (Signer, error) {
+	algorithm := signingKeyParamsOf(s).algorithm
+	if s.Spec.ExternalSigner != nil {
+		transit, err := vaultTransitFor(ctx, c, s)
+		if err != nil {
+			return nil, err
+		}
+		return newRemoteSigner(ctx, transit, algorithm)
+	}
+
+	ref := signingSecretOf(s)
+	secret, err := getSecret(ctx, c, ref.name, s.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSecretSigner(secret, ref.keyFile, algorithm)
+}
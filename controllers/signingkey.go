@@ -0,0 +1,297 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// JWT signing algorithms
+const (
+	algRS256 = "RS256"
+	algPS256 = "PS256"
+	algES256 = "ES256"
+	algEdDSA = "EdDSA"
+)
+
+// defaultRSAKeySize is the size in bits of generated RSA signing keys
+const defaultRSAKeySize = 4096
+
+// signingAlgorithmAnnotation records the signing algorithm of the active key on the JWT secret
+const signingAlgorithmAnnotation = "kubegateway.kubevirt.io/signing-algorithm"
+
+// keyAlgorithmHeader is the PEM header recording the signing algorithm of a public key
+const keyAlgorithmHeader = "Algorithm"
+
+// signingKeyParams are the parameters used to generate a signing key
+type signingKeyParams struct {
+	algorithm  string
+	rsaKeySize int
+}
+
+// signingKeyParamsOf returns the signing key parameters set in the spec
+func signingKeyParamsOf(s *kubegatewayv1beta1.GateServer) signingKeyParams {
+	params := signingKeyParams{
+		algorithm:  s.Spec.SigningAlgorithm,
+		rsaKeySize: s.Spec.RSAKeySize,
+	}
+
+	if params.algorithm == "" {
+		params.algorithm = algRS256
+	}
+	if params.rsaKeySize == 0 {
+		params.rsaKeySize = defaultRSAKeySize
+	}
+
+	return params
+}
+
+// generateSigningKey creates a private key for a signing algorithm
+func generateSigningKey(params signingKeyParams) (crypto.Signer, error) {
+	switch params.algorithm {
+	case algRS256, algPS256:
+		return generatePrivateKey(params.rsaKeySize)
+	case algES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case algEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", params.algorithm)
+	}
+}
+
+// keyMatchesAlgorithm checks that a key can be used by a signing algorithm
+func keyMatchesAlgorithm(pub crypto.PublicKey, algorithm string) bool {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return algorithm == algRS256 || algorithm == algPS256
+	case *ecdsa.PublicKey:
+		return algorithm == algES256 && key.Curve == elliptic.P256()
+	case ed25519.PublicKey:
+		return algorithm == algEdDSA
+	default:
+		return false
+	}
+}
+
+// defaultAlgorithm returns the signing algorithm of a key, when it is not recorded
+func defaultAlgorithm(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return algES256
+	case ed25519.PublicKey:
+		return algEdDSA
+	default:
+		return algRS256
+	}
+}
+
+// jwtSigningMethod returns the JWT signing method of a signing algorithm
+func jwtSigningMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case algRS256:
+		return jwt.SigningMethodRS256, nil
+	case algPS256:
+		return jwt.SigningMethodPS256, nil
+	case algES256:
+		return jwt.SigningMethodES256, nil
+	case algEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+}
+
+// secretAlgorithm returns the signing algorithm of the private key in a secret, the
+// algorithm is read from the secret annotation, or derived from the key type.
+func secretAlgorithm(secret *corev1.Secret, key crypto.Signer) string {
+	if algorithm, ok := secret.Annotations[signingAlgorithmAnnotation]; ok && keyMatchesAlgorithm(key.Public(), algorithm) {
+		return algorithm
+	}
+
+	return defaultAlgorithm(key.Public())
+}
+
+// parsePrivateKeyPEM parses a PKCS#8, PKCS#1 or SEC 1 PEM encoded private key
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("failed to parse private key")
+}
+
+// parsePublicKeyPEM parses the first PEM encoded public key or certificate
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+
+	if block.Type == "CERTIFICATE" {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			return cert.PublicKey, nil
+		}
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// Default entries of the secret holding the JWT signing key
+const (
+	defaultSigningKeyFile  = "tls.key"
+	defaultSigningCertFile = "tls.crt"
+
+	// publicKeysFile holds the public keys valid for verification of a
+	// generated secret, with their life cycle recorded in PEM headers
+	publicKeysFile = "public.pem"
+)
+
+// signingSecret locates the JWT signing key of a server
+type signingSecret struct {
+	name     string
+	certFile string
+
+	// keyFile is empty when the private key is held by an external signer
+	keyFile string
+
+	// publicKeysFile is the entry listing the public keys valid for verification
+	publicKeysFile string
+}
+
+// publicKeys returns the public keys valid for verification, the active key first
+func (ref signingSecret) publicKeys(secret *corev1.Secret) []*pem.Block {
+	keys := publicKeyBlocks(secret, ref.publicKeysFile)
+
+	// Secrets created by older versions list the public keys in the certificate entry
+	if len(keys) == 0 && ref.publicKeysFile != ref.certFile {
+		keys = publicKeyBlocks(secret, ref.certFile)
+	}
+
+	return keys
+}
+
+// jwtSecretName is the name of the secret holding the signing key generated by the operator
+func jwtSecretName(s *kubegatewayv1beta1.GateServer) string {
+	return fmt.Sprintf("%s-jwt-secret", s.Name)
+}
+
+// signingSecretOf returns the secret holding the signing key of a server, the user supplied
+// secret set in the spec, or the secret generated by the operator. When the server uses an
+// external signer, the generated secret holds only the public keys.
+func signingSecretOf(s *kubegatewayv1beta1.GateServer) signingSecret {
+	if s.Spec.ExternalSigner != nil {
+		return signingSecret{
+			name:           jwtSecretName(s),
+			certFile:       defaultSigningCertFile,
+			publicKeysFile: publicKeysFile,
+		}
+	}
+	if s.Spec.SigningKey == nil {
+		return signingSecret{
+			name:           jwtSecretName(s),
+			keyFile:        defaultSigningKeyFile,
+			certFile:       defaultSigningCertFile,
+			publicKeysFile: publicKeysFile,
+		}
+	}
+
+	ref := signingSecret{
+		name:     s.Spec.SigningKey.Name,
+		keyFile:  s.Spec.SigningKey.KeyFile,
+		certFile: s.Spec.SigningKey.CertFile,
+	}
+	if ref.keyFile == "" {
+		ref.keyFile = defaultSigningKeyFile
+	}
+	if ref.certFile == "" {
+		ref.certFile = defaultSigningCertFile
+	}
+	ref.publicKeysFile = ref.certFile
+
+	return ref
+}
+
+// getSigningSecret reads the secret holding the signing key of a server
+func (r *GateServerReconciler) getSigningSecret(ctx context.Context, s *kubegatewayv1beta1.GateServer) (*corev1.Secret, signingSecret, error) {
+	ref := signingSecretOf(s)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.name, Namespace: s.Namespace}, secret); err != nil {
+		return nil, ref, err
+	}
+
+	return secret, ref, nil
+}
+
+// validateSigningKey checks that a user supplied secret holds a private key matching
+// the signing algorithm, and the matching public key or certificate.
+func validateSigningKey(secret *corev1.Secret, ref signingSecret, algorithm string) error {
+	privateKey, err := parsePrivateKeyPEM(secret.Data[ref.keyFile])
+	if err != nil {
+		return fmt.Errorf("secret %s %q entry: %w", ref.name, ref.keyFile, err)
+	}
+	if !keyMatchesAlgorithm(privateKey.Public(), algorithm) {
+		return fmt.Errorf("secret %s private key type %T can not be used by the %s signing algorithm", ref.name, privateKey, algorithm)
+	}
+
+	keys := ref.publicKeys(secret)
+	if len(keys) == 0 {
+		return fmt.Errorf("secret %s %q entry does not hold a PEM public key or certificate", ref.name, ref.certFile)
+	}
+
+	privateKID, err := keyID(privateKey.Public())
+	if err != nil {
+		return err
+	}
+	if blockKeyID(keys[0]) != privateKID {
+		return fmt.Errorf("secret %s public key does not match the private key", ref.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+var _ = Describe("Signing algorithms", func() {
+	var r *GateServerReconciler
+	var s *kubegatewayv1beta1.GateServer
+
+	BeforeEach(func() {
+		r = newGateServerReconciler()
+		s = &kubegatewayv1beta1.GateServer{ObjectMeta: metav1.ObjectMeta{Name: "gateserver-sample", Namespace: "ns"}}
+		s.Spec.RSAKeySize = 2048
+	})
+
+	table.DescribeTable("signs tokens verified by the published public key",
+		func(algorithm string, kty string) {
+			s.Spec.SigningAlgorithm = algorithm
+			secret, err := r.Secret(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Annotations).To(HaveKeyWithValue(signingAlgorithmAnnotation, algorithm))
+
+			signer, err := newSecretSigner(secret, defaultSigningKeyFile, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signer.Algorithm()).To(Equal(algorithm))
+
+			token := &kubegatewayv1beta1.GateToken{}
+			token.Status.Data.URLs = []string{"/api/v1/namespaces/ns/pods"}
+			Expect(singToken(context.Background(), token, signer)).To(Succeed())
+
+			pub, err := parsePublicKeyPEM(secret.Data[publicKeysFile])
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := jwt.Parse(token.Status.Token, func(*jwt.Token) (interface{}, error) {
+				return pub, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Header["alg"]).To(Equal(algorithm))
+
+			blocks := signingSecretOf(s).publicKeys(secret)
+			Expect(blocks).To(HaveLen(1))
+			jwk, err := blockJWK(blocks[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jwk.Kty).To(Equal(kty))
+			Expect(jwk.Alg).To(Equal(algorithm))
+		},
+		table.Entry("RS256", algRS256, "RSA"),
+		table.Entry("PS256", algPS256, "RSA"),
+		table.Entry("ES256", algES256, "EC"),
+		table.Entry("EdDSA", algEdDSA, "OKP"),
+	)
+
+	It("keeps the key when the new algorithm can use it", func() {
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+		keys := rotateAt(r, s, secret, tokenExpiry{}, time.Now())
+
+		s.Spec.SigningAlgorithm = algPS256
+		Expect(rotateAt(r, s, secret, tokenExpiry{}, time.Now())).To(Equal(keys))
+		Expect(secret.Annotations).To(HaveKeyWithValue(signingAlgorithmAnnotation, algPS256))
+
+		signer, err := newSecretSigner(secret, defaultSigningKeyFile, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.Algorithm()).To(Equal(algPS256))
+	})
+
+	It("generates a new key when the new algorithm uses another key type", func() {
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+		keys := rotateAt(r, s, secret, tokenExpiry{}, time.Now())
+
+		s.Spec.SigningAlgorithm = algES256
+		rotated := rotateAt(r, s, secret, tokenExpiry{}, time.Now())
+		Expect(rotated[0]).NotTo(Equal(keys[0]))
+
+		signer, err := newSecretSigner(secret, defaultSigningKeyFile, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.Algorithm()).To(Equal(algES256))
+		Expect(signer.KeyID()).To(Equal(rotated[0]))
+	})
+
+	It("rejects a key the algorithm can not use", func() {
+		s.Spec.SigningAlgorithm = algES256
+		secret, err := r.Secret(s)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = newSecretSigner(secret, defaultSigningKeyFile, algRS256)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,299 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// defaultTransitMountPath is the default mount path of the transit secrets engine
+const defaultTransitMountPath = "transit"
+
+// vaultRequestTimeout is the timeout of requests to the signing service
+const vaultRequestTimeout = 10 * time.Second
+
+// vaultTransit is a client of a Vault transit secrets engine signing key
+type vaultTransit struct {
+	client    *http.Client
+	url       string
+	mountPath string
+	keyName   string
+	token     string
+}
+
+// vaultKeyVersion is a version of a transit signing key
+type vaultKeyVersion struct {
+	version   int
+	publicKey crypto.PublicKey
+	created   time.Time
+}
+
+// newVaultTransit creates a client of a transit signing key, the CA bundle is optional
+func newVaultTransit(url string, mountPath string, keyName string, token string, ca []byte) (*vaultTransit, error) {
+	if mountPath == "" {
+		mountPath = defaultTransitMountPath
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("signing service CA bundle is not PEM encoded")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &vaultTransit{
+		client:    &http.Client{Transport: transport, Timeout: vaultRequestTimeout},
+		url:       strings.TrimSuffix(url, "/"),
+		mountPath: strings.Trim(mountPath, "/"),
+		keyName:   keyName,
+		token:     token,
+	}, nil
+}
+
+// vaultTransitFor creates a client of the external signer of a server, using the credentials secret
+func vaultTransitFor(ctx context.Context, c client.Client, s *kubegatewayv1beta1.GateServer) (*vaultTransit, error) {
+	signer := s.Spec.ExternalSigner
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: signer.CredentialsSecret, Namespace: s.Namespace}, secret); err != nil {
+		return nil, err
+	}
+	if len(secret.Data["token"]) == 0 {
+		return nil, fmt.Errorf("secret %s is missing the \"token\" entry", signer.CredentialsSecret)
+	}
+
+	return newVaultTransit(signer.URL, signer.MountPath, signer.KeyName, string(secret.Data["token"]), secret.Data["ca.crt"])
+}
+
+// do sends a request to the transit secrets engine and decodes the response data
+func (v *vaultTransit) do(ctx context.Context, method string, path string, body interface{}, data interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/v1/%s/%s/%s", v.url, v.mountPath, path, v.keyName), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signing service returned %s for %s %s", resp.Status, method, path)
+	}
+
+	response := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	return json.NewDecoder(resp.Body).Decode(&response)
+}
+
+// keys reads the public keys of the signing key versions, the latest version first
+func (v *vaultTransit) keys(ctx context.Context) ([]vaultKeyVersion, error) {
+	data := struct {
+		Type string `json:"type"`
+		Keys map[string]struct {
+			PublicKey    string `json:"public_key"`
+			CreationTime string `json:"creation_time"`
+		} `json:"keys"`
+	}{}
+	if err := v.do(ctx, http.MethodGet, "keys", nil, &data); err != nil {
+		return nil, err
+	}
+
+	versions := []vaultKeyVersion{}
+	for name, key := range data.Keys {
+		version, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key version %q", name)
+		}
+
+		publicKey, err := parseVaultPublicKey(data.Type, key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key version %d: %w", version, err)
+		}
+
+		created, _ := time.Parse(time.RFC3339Nano, key.CreationTime)
+		versions = append(versions, vaultKeyVersion{version: version, publicKey: publicKey, created: created})
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("signing key %s has no public keys", v.keyName)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].version > versions[j].version })
+	return versions, nil
+}
+
+// parseVaultPublicKey parses a transit public key, PEM encoded, or base64 encoded for ed25519 keys
+func parseVaultPublicKey(keyType string, publicKey string) (crypto.PublicKey, error) {
+	if keyType == "ed25519" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key size %d", len(key))
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	return parsePublicKeyPEM([]byte(publicKey))
+}
+
+// sign signs the input using a version of the signing key, the signature is encoded as used in JWS
+func (v *vaultTransit) sign(ctx context.Context, version int, algorithm string, input []byte) ([]byte, error) {
+	body := map[string]interface{}{
+		"input":          base64.StdEncoding.EncodeToString(input),
+		"key_version":    version,
+		"hash_algorithm": "sha2-256",
+	}
+	switch algorithm {
+	case algRS256:
+		body["signature_algorithm"] = "pkcs1v15"
+	case algPS256:
+		// JWS requires a salt as long as the hash, Vault defaults to the longest salt
+		body["signature_algorithm"] = "pss"
+		body["salt_length"] = "hash"
+	case algES256:
+		body["marshaling_algorithm"] = "jws"
+	}
+
+	data := struct {
+		Signature string `json:"signature"`
+	}{}
+	if err := v.do(ctx, http.MethodPost, "sign", body, &data); err != nil {
+		return nil, err
+	}
+
+	// Signatures are prefixed by the key version, e.g. "vault:v1:<signature>"
+	parts := strings.SplitN(data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("unexpected signature format")
+	}
+
+	// JWS marshaled signatures are URL-safe base64 encoded
+	if signature, err := base64.StdEncoding.DecodeString(parts[2]); err == nil {
+		return signature, nil
+	}
+	return base64.RawURLEncoding.DecodeString(parts[2])
+}
+
+// remoteSigner signs tokens using the latest version of a transit signing key,
+// the private key never leaves the signing service.
+type remoteSigner struct {
+	transit   *vaultTransit
+	version   int
+	algorithm string
+	kid       string
+}
+
+// newRemoteSigner creates a signer using the latest version of a transit signing key
+func newRemoteSigner(ctx context.Context, transit *vaultTransit, algorithm string) (*remoteSigner, error) {
+	versions, err := transit.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := versions[0]
+	if !keyMatchesAlgorithm(latest.publicKey, algorithm) {
+		return nil, fmt.Errorf("signing key %s type %T can not be used by the %s signing algorithm", transit.keyName, latest.publicKey, algorithm)
+	}
+
+	kid, err := keyID(latest.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteSigner{transit: transit, version: latest.version, algorithm: algorithm, kid: kid}, nil
+}
+
+// Algorithm implements Signer
+func (s *remoteSigner) Algorithm() string {
+	return s.algorithm
+}
+
+// KeyID implements Signer
+func (s *remoteSigner) KeyID() string {
+	return s.kid
+}
+
+// Sign implements Signer
+func (s *remoteSigner) Sign(ctx context.Context, signingInput string) ([]byte, error) {
+	return s.transit.sign(ctx, s.version, s.algorithm, []byte(signingInput))
+}
+
+// externalSignerPublicKeys encodes the public keys of the external signer of a server
+// as a PEM bundle, the latest key version first.
+func externalSignerPublicKeys(ctx context.Context, transit *vaultTransit, algorithm string) ([]byte, error) {
+	versions, err := transit.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !keyMatchesAlgorithm(versions[0].publicKey, algorithm) {
+		return nil, fmt.Errorf("signing key %s type %T can not be used by the %s signing algorithm", transit.keyName, versions[0].publicKey, algorithm)
+	}
+
+	bundle := []byte{}
+	for _, version := range versions {
+		keyAlgorithm := algorithm
+		if !keyMatchesAlgorithm(version.publicKey, algorithm) {
+			keyAlgorithm = defaultAlgorithm(version.publicKey)
+		}
+
+		block, err := publicKeyToPEMBlock(version.publicKey, keyAlgorithm, version.created)
+		if err != nil {
+			return nil, err
+		}
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+
+	return bundle, nil
+}
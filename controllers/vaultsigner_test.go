@@ -0,0 +1,191 @@
+/*
+Copyright 2021 Yaacov Zamir.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	kubegatewayv1beta1 "github.com/kubevirt-ui/kube-gateway-operator/api/v1beta1"
+)
+
+// transitStub serves the sign and keys endpoints of a Vault transit secrets engine,
+// PSS signatures are only served with a salt as long as the hash, as required by JWS.
+func transitStub(key crypto.Signer, keyType string) *httptest.Server {
+	publicKey := ""
+	if k, ok := key.Public().(ed25519.PublicKey); ok {
+		publicKey = base64.StdEncoding.EncodeToString(k)
+	} else {
+		block, err := publicKeyToPEMBlock(key.Public(), "", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		block.Headers = nil
+		publicKey = string(pem.EncodeToMemory(block))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/transit/keys/gateway", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprintf(w, `{"data":{"type":%q,"latest_version":1,"keys":{"1":{"public_key":%q,"creation_time":"2021-06-01T00:00:00Z"}}}}`,
+			keyType, publicKey)
+	})
+	mux.HandleFunc("/v1/transit/sign/gateway", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		input, _ := base64.StdEncoding.DecodeString(body["input"].(string))
+		digest := sha256.Sum256(input)
+
+		var signature string
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			var sig []byte
+			switch body["signature_algorithm"] {
+			case "pss":
+				if body["salt_length"] != "hash" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				sig, _ = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			default:
+				sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+			}
+			signature = base64.StdEncoding.EncodeToString(sig)
+		case *ecdsa.PrivateKey:
+			sigR, sigS, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+			sig := append(padBytes(sigR.Bytes(), 32), padBytes(sigS.Bytes(), 32)...)
+			signature = base64.RawURLEncoding.EncodeToString(sig)
+		case ed25519.PrivateKey:
+			signature = base64.StdEncoding.EncodeToString(ed25519.Sign(k, input))
+		}
+
+		fmt.Fprintf(w, `{"data":{"signature":"vault:v1:%s"}}`, signature)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+var _ = Describe("Vault transit signer", func() {
+	var rsaKey *rsa.PrivateKey
+	var ecKey *ecdsa.PrivateKey
+	var edKey ed25519.PrivateKey
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		_, edKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// keyOf returns the test key of a transit key type
+	keyOf := func(keyType string) crypto.Signer {
+		switch {
+		case strings.HasPrefix(keyType, "rsa"):
+			return rsaKey
+		case strings.HasPrefix(keyType, "ecdsa"):
+			return ecKey
+		default:
+			return edKey
+		}
+	}
+
+	table.DescribeTable("signs tokens verified by the transit public key",
+		func(algorithm string, keyType string) {
+			key := keyOf(keyType)
+			server := transitStub(key, keyType)
+			defer server.Close()
+
+			transit, err := newVaultTransit(server.URL, "", "gateway", "test-token", nil)
+			Expect(err).NotTo(HaveOccurred())
+			signer, err := newRemoteSigner(context.Background(), transit, algorithm)
+			Expect(err).NotTo(HaveOccurred())
+
+			token := &kubegatewayv1beta1.GateToken{}
+			token.Status.Data.URLs = []string{"/apis/subresources.kubevirt.io/*"}
+			Expect(singToken(context.Background(), token, signer)).To(Succeed())
+
+			parsed, err := jwt.Parse(token.Status.Token, func(*jwt.Token) (interface{}, error) {
+				return key.Public(), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			kid, err := keyID(key.Public())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Header["kid"]).To(Equal(kid))
+			Expect(parsed.Header["alg"]).To(Equal(algorithm))
+		},
+		table.Entry("RS256", algRS256, "rsa-2048"),
+		table.Entry("PS256", algPS256, "rsa-2048"),
+		table.Entry("ES256", algES256, "ecdsa-p256"),
+		table.Entry("EdDSA", algEdDSA, "ed25519"),
+	)
+
+	It("signs PS256 tokens with a salt as long as the hash", func() {
+		server := transitStub(rsaKey, "rsa-2048")
+		defer server.Close()
+
+		transit, err := newVaultTransit(server.URL, "", "gateway", "test-token", nil)
+		Expect(err).NotTo(HaveOccurred())
+		signer, err := newRemoteSigner(context.Background(), transit, algPS256)
+		Expect(err).NotTo(HaveOccurred())
+
+		signingInput := "header.claims"
+		signature, err := signer.Sign(context.Background(), signingInput)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest := sha256.Sum256([]byte(signingInput))
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		Expect(rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature, opts)).To(Succeed())
+	})
+
+	It("rejects an algorithm the transit key can not sign", func() {
+		server := transitStub(ecKey, "ecdsa-p256")
+		defer server.Close()
+
+		transit, err := newVaultTransit(server.URL, "", "gateway", "test-token", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = newRemoteSigner(context.Background(), transit, algRS256)
+		Expect(err).To(HaveOccurred())
+	})
+})
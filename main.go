@@ -89,14 +89,36 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "GateToken")
 		os.Exit(1)
 	}
+	// Detect optional APIs, e.g. OpenShift routes and the Gateway API
+	apis, err := controllers.DiscoverClusterAPIs(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to discover cluster APIs")
+		os.Exit(1)
+	}
+	setupLog.Info("discovered cluster APIs", "route", apis.Route, "ingress", apis.Ingress, "httproute", apis.HTTPRoute.String(),
+		"backendtlspolicy", apis.BackendTLSPolicy.String(),
+		"service-ca", apis.ServiceCA, "cert-manager", apis.CertManager, "oauth-client", apis.OAuthClient)
+
 	if err = (&controllers.GateServerReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("GateServer"),
 		Scheme: mgr.GetScheme(),
+		APIs:   apis,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GateServer")
 		os.Exit(1)
 	}
+	// Admission webhooks require a serving certificate, disable them when running locally
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&kubegatewayv1beta1.GateToken{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "GateToken")
+			os.Exit(1)
+		}
+		if err = (&kubegatewayv1beta1.GateServer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "GateServer")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {